@@ -0,0 +1,215 @@
+package calculate
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+type archiveFormat int
+
+const (
+	notArchive archiveFormat = iota
+	zipArchive
+	tarArchive
+	tarGzArchive
+)
+
+var archiveSuffixes = []struct {
+	suffix string
+	format archiveFormat
+}{
+	{".tar.gz", tarGzArchive},
+	{".tgz", tarGzArchive},
+	{".tar", tarArchive},
+	{".zip", zipArchive},
+	{".jar", zipArchive},
+	{".war", zipArchive},
+	{".ear", zipArchive},
+}
+
+func getArchiveFormat(name string) archiveFormat {
+	name = strings.ToLower(name)
+	for _, archiveSuffix := range archiveSuffixes {
+		if strings.HasSuffix(name, archiveSuffix.suffix) {
+			return archiveSuffix.format
+		}
+	}
+	return notArchive
+}
+
+func isArchive(name string) bool {
+	return getArchiveFormat(name) != notArchive
+}
+
+// AnalyzeArchive summarizes the complexity of every supported source file inside the zip, jar, tar or tar.gz
+// archive at name in fsys, without extracting it. Entries are matched against patterns by their path inside the archive.
+func AnalyzeArchive(ctx context.Context, fsys fs.FS, name string, cfg Config) (*CodeSummary, error) {
+	if !isArchive(name) {
+		return nil, fmt.Errorf("'%v' is not a supported archive", name)
+	}
+
+	a, err := newAnalyzerForConfig(fsys, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive at '%v': %v", name, err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat archive at '%v': %v", name, err)
+	}
+
+	err = a.visitArchive(ctx, name, "", file, info.Size(), 0)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return a.summarize(), nil
+}
+
+var errArchiveTooLarge = errors.New("archives are too large")
+
+// budgetReader fails reading once the total bytes read from archives pass the analyzer limit
+type budgetReader struct {
+	io.ReadCloser
+	a *analyzer
+}
+
+func (r *budgetReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.a.archiveBytes += int64(n)
+	if r.a.maxArchiveBytes > 0 && r.a.archiveBytes > r.a.maxArchiveBytes {
+		return n, errArchiveTooLarge
+	}
+	return n, err
+}
+
+func (a *analyzer) budgeted(open func() (io.ReadCloser, error)) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		reader, err := open()
+		if err != nil {
+			return nil, err
+		}
+		return &budgetReader{ReadCloser: reader, a: a}, nil
+	}
+}
+
+// visitNestedArchive opens an archive found while walking, if not yet deeper than allowed
+func (a *analyzer) visitNestedArchive(ctx context.Context, archivePath string, size int64, open func() (io.ReadCloser, error), depth int) error {
+	if depth >= a.maxArchiveDepth {
+		a.verboseLog("--- archive '%v' is nested too deep", archivePath)
+		return nil
+	}
+	if a.isExcluded(archivePath) {
+		a.verboseLog("--- archive '%v' is excluded by patterns", archivePath)
+		return nil
+	}
+	reader, err := open()
+	if err != nil {
+		return fmt.Errorf("failed to open archive at '%v': %v", archivePath, err)
+	}
+	defer reader.Close()
+	return a.visitArchive(ctx, archivePath, archivePath, reader, size, depth+1)
+}
+
+func (a *analyzer) visitArchive(ctx context.Context, archivePath string, prefix string, reader io.Reader, size int64, depth int) error {
+	a.verboseLog(">>> archive '%v'", archivePath)
+
+	format := getArchiveFormat(archivePath)
+	if format == zipArchive {
+		readerAt, isReaderAt := reader.(io.ReaderAt)
+		if !isReaderAt {
+			// zip needs random access, nested zip archives are read to memory within the archives budget
+			content, err := io.ReadAll(reader)
+			if err != nil {
+				return fmt.Errorf("failed to read archive at '%v': %w", archivePath, err)
+			}
+			readerAt, size = bytes.NewReader(content), int64(len(content))
+		}
+		zipReader, err := zip.NewReader(readerAt, size)
+		if err != nil {
+			return fmt.Errorf("failed to read archive at '%v': %v", archivePath, err)
+		}
+		for _, file := range zipReader.File {
+			if !file.Mode().IsRegular() {
+				continue
+			}
+			err = a.visitArchiveEntry(ctx, path.Join(prefix, file.Name), int64(file.UncompressedSize64), file.Open, depth)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if format == tarGzArchive {
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return fmt.Errorf("failed to read archive at '%v': %v", archivePath, err)
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive at '%v': %w", archivePath, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		err = a.visitArchiveEntry(ctx, path.Join(prefix, header.Name), header.Size, func() (io.ReadCloser, error) {
+			return io.NopCloser(tarReader), nil
+		}, depth)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (a *analyzer) visitArchiveEntry(ctx context.Context, entryPath string, size int64, open func() (io.ReadCloser, error), depth int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	a.archiveEntries++
+	if a.maxArchiveEntries > 0 && a.archiveEntries > a.maxArchiveEntries {
+		return fmt.Errorf("archives have more than %v entries", a.maxArchiveEntries)
+	}
+	for dir := path.Dir(entryPath); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if a.isExcluded(dir) {
+			a.verboseLog("--- file '%v' is in a dir excluded by patterns", entryPath)
+			return nil
+		}
+	}
+
+	var err error
+	if isArchive(entryPath) {
+		err = a.visitNestedArchive(ctx, entryPath, size, a.budgeted(open), depth)
+	} else {
+		err = a.visitFile(entryPath, size, a.budgeted(open))
+	}
+	if errors.Is(err, errArchiveTooLarge) {
+		return fmt.Errorf("archives have more than %v MB of content", a.maxArchiveBytes/(1024*1024))
+	}
+	return err
+}
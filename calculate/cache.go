@@ -0,0 +1,198 @@
+package calculate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// countingVersion is the version of the cached counters and of how files are counted, bump it with any change to
+// either, so the entries counted before are not used
+const countingVersion = 12
+
+// Cache stores the counters of files on disk, by the hash of their content, the tool version, the counting version and
+// the language definition, so unchanged files are not analyzed again. It is safe for concurrent use.
+type Cache struct {
+	dir             string
+	version         string
+	countingVersion int
+	maxBytes        int64
+	hits            atomic.Int64
+	misses          atomic.Int64
+}
+
+// OpenCache uses dir as a cache for the given tool version, first pruning it to maxBytes, or never if zero
+func OpenCache(dir string, version string, maxBytes int64) (*Cache, error) {
+	err := os.MkdirAll(dir, 0777)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache dir at '%v': %v", dir, err)
+	}
+	c := &Cache{
+		dir:             dir,
+		version:         version,
+		countingVersion: countingVersion,
+		maxBytes:        maxBytes,
+	}
+	err = c.Prune()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// key is the hash of the content and of everything it is counted by, the definition hash changes with the language
+func (c *Cache) key(fileBytes []byte, language Language, definitionHash string) string {
+	hash := sha256.New()
+	_, _ = fmt.Fprintf(hash, "%v\x00%v\x00%v\x00%v\x00", c.version, c.countingVersion, language, definitionHash)
+	_, _ = hash.Write(fileBytes)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (c *Cache) entryPath(key string) string {
+	return filepath.Join(c.dir, key[:2], key[2:]+".json")
+}
+
+func (c *Cache) get(key string) (*CodeCounters, bool) {
+	entryPath := c.entryPath(key)
+	content, err := os.ReadFile(entryPath)
+	if err != nil {
+		c.misses.Add(1)
+		return nil, false
+	}
+	fileCounters := &FileCounters{}
+	err = json.Unmarshal(content, fileCounters)
+	if err != nil {
+		c.misses.Add(1)
+		return nil, false
+	}
+	// recently used entries are the last to be pruned
+	now := time.Now()
+	_ = os.Chtimes(entryPath, now, now)
+	c.hits.Add(1)
+	counters := CodeCounters(*fileCounters)
+	return &counters, true
+}
+
+func (c *Cache) put(key string, counters *CodeCounters) error {
+	content, err := json.Marshal(FileCounters(*counters))
+	if err != nil {
+		return err
+	}
+	entryPath := c.entryPath(key)
+	err = os.MkdirAll(filepath.Dir(entryPath), 0777)
+	if err != nil {
+		return err
+	}
+	// written aside and renamed, so concurrent runs never read a partial entry
+	tempFile, err := os.CreateTemp(filepath.Dir(entryPath), "*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tempFile.Write(content)
+	closeErr := tempFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), entryPath)
+	}
+	if err != nil {
+		_ = os.Remove(tempFile.Name())
+	}
+	return err
+}
+
+// Stats are the number of cache hits and misses so far
+func (c *Cache) Stats() (hits int64, misses int64) {
+	return c.hits.Load(), c.misses.Load()
+}
+
+type cacheEntry struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// Prune removes the least recently used entries until the cache is within its size limit, leaving any other files in
+// its dir
+func (c *Cache) Prune() error {
+	if c.maxBytes <= 0 {
+		return nil
+	}
+	shards, err := os.ReadDir(c.dir)
+	if err != nil {
+		return fmt.Errorf("failed to list cache at '%v': %v", c.dir, err)
+	}
+	var entries []cacheEntry
+	totalBytes := int64(0)
+	for _, shard := range shards {
+		if !isCacheShard(shard) {
+			continue
+		}
+		shardPath := filepath.Join(c.dir, shard.Name())
+		files, err := os.ReadDir(shardPath)
+		if err != nil {
+			return fmt.Errorf("failed to list cache at '%v': %v", c.dir, err)
+		}
+		for _, file := range files {
+			if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+				continue
+			}
+			info, err := file.Info()
+			if err != nil {
+				return fmt.Errorf("failed to list cache at '%v': %v", c.dir, err)
+			}
+			entries = append(entries, cacheEntry{path: filepath.Join(shardPath, file.Name()), size: info.Size(), modTime: info.ModTime()})
+			totalBytes += info.Size()
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].modTime.Before(entries[j].modTime)
+	})
+	for _, entry := range entries {
+		if totalBytes <= c.maxBytes {
+			break
+		}
+		err = os.Remove(entry.path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to prune cache entry at '%v': %v", entry.path, err)
+		}
+		totalBytes -= entry.size
+	}
+	return nil
+}
+
+// isCacheShard is whether the entry is a dir of cache entries, named by the first 2 hex digits of their keys
+func isCacheShard(entry fs.DirEntry) bool {
+	_, err := hex.DecodeString(entry.Name())
+	return err == nil && len(entry.Name()) == 2 && entry.IsDir()
+}
+
+// CleanCache removes all entries of the cache at dir, leaving any other files in it
+func CleanCache(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list cache at '%v': %v", dir, err)
+	}
+	for _, entry := range entries {
+		if !isCacheShard(entry) {
+			continue
+		}
+		err = os.RemoveAll(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to clean cache at '%v': %v", dir, err)
+		}
+	}
+	return nil
+}
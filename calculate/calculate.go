@@ -1,150 +1,618 @@
 package calculate
 
 import (
+	"bufio"
 	"code-complexity/options"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/gobwas/glob"
 	"golang.org/x/net/html/charset"
 )
 
-type context struct {
+// Config holds the settings of a single analysis, independent of the command line.
+type Config struct {
+	IncludePatterns []string
+	ExcludePatterns []string
+	VerboseLogging  bool
+	// MaxFileSizeBytes skips files larger than this size, or no limit if zero
+	MaxFileSizeBytes int64
+	// MaxArchiveDepth is how many levels of archives found while walking are opened, zero skips them
+	MaxArchiveDepth int
+	// MaxArchiveEntries fails the analysis once more archive entries are visited, or no limit if zero
+	MaxArchiveEntries int
+	// MaxArchiveBytes fails the analysis once more bytes are decompressed from archives, or no limit if zero
+	MaxArchiveBytes int64
+	// Cache reuses the counters of files that were analyzed before, if set
+	Cache *Cache
+	// Languages are added to the built-in languages, replacing those with the same name
+	Languages []LanguageDefinition
+	// ExcludeJsxIndentation leaves lines of jsx elements out of the indentation counters
+	ExcludeJsxIndentation bool
+	// DetectSqlDialects summarizes sql files as plsql, tsql or plpgsql by their content, and all of them as sql too
+	DetectSqlDialects bool
+	// MaxNesting is the nesting depth lines of code are counted as deep beyond, or 4 if zero
+	MaxNesting int
+	// TabWidth is the columns of a tab, unless set by the language or by .editorconfig files, or 4 if zero
+	TabWidth int
+}
+
+type analyzer struct {
 	CodeSummary
-	includePatterns  []glob.Glob
-	excludePatterns  []glob.Glob
-	verboseLogging   bool
-	maxFileSizeBytes int64
+	fsys                  fs.FS
+	includePatterns       []glob.Glob
+	excludePatterns       []glob.Glob
+	verboseLogging        bool
+	maxFileSizeBytes      int64
+	maxArchiveDepth       int
+	maxArchiveEntries     int
+	maxArchiveBytes       int64
+	archiveEntries        int
+	archiveBytes          int64
+	cache                 *Cache
+	languages             *languages
+	excludeJsxIndentation bool
+	detectSqlDialects     bool
+	maxNesting            int
+	defaultTabWidth       int
+	// dirFiles are the file names by dir, listed when disambiguating languages
+	dirFiles map[string][]string
+	// files are the counters of every counted file, by the languages in it, only kept when watching
+	files map[string][]*fileResult
+	// editorconfigs are the .editorconfig files by dir, nil for dirs without one
+	editorconfigs map[string]*editorconfig
+}
+
+type fileResult struct {
+	language Language
+	counters *CodeCounters
 }
 
-func newContext() *context {
-	return &context{
+func newAnalyzer() *analyzer {
+	return &analyzer{
 		CodeSummary: CodeSummary{
 			CountersByLanguage: make(map[Language]*SummaryCounters),
 		},
+		languages:       builtins,
+		maxNesting:      defaultMaxNesting,
+		defaultTabWidth: defaultTabWidth,
 	}
 }
 
-func Complexity(opts *options.Options) (*CodeSummary, error) {
-
-	includePatterns, err := compileGlobs(opts.IncludePatterns)
+func newAnalyzerForConfig(fsys fs.FS, cfg Config) (*analyzer, error) {
+	includePatterns, err := compileGlobs(cfg.IncludePatterns)
 	if err != nil {
 		return nil, fmt.Errorf("failed to compile include patterns: %v", err)
 	}
-	excludePatterns, err := compileGlobs(opts.ExcludePatterns)
+	excludePatterns, err := compileGlobs(cfg.ExcludePatterns)
 	if err != nil {
 		return nil, fmt.Errorf("failed to compile exclude patterns: %v", err)
 	}
-	ctx := newContext()
-	ctx.includePatterns = includePatterns
-	ctx.excludePatterns = excludePatterns
-	ctx.verboseLogging = opts.VerboseLogging
-	ctx.maxFileSizeBytes = opts.MaxFileSizeBytes
+	a := newAnalyzer()
+	a.fsys = fsys
+	a.includePatterns = includePatterns
+	a.excludePatterns = excludePatterns
+	a.verboseLogging = cfg.VerboseLogging
+	a.maxFileSizeBytes = cfg.MaxFileSizeBytes
+	a.maxArchiveDepth = cfg.MaxArchiveDepth
+	a.maxArchiveEntries = cfg.MaxArchiveEntries
+	a.maxArchiveBytes = cfg.MaxArchiveBytes
+	a.cache = cfg.Cache
+	a.excludeJsxIndentation = cfg.ExcludeJsxIndentation
+	a.detectSqlDialects = cfg.DetectSqlDialects
+	if cfg.MaxNesting > 0 {
+		a.maxNesting = cfg.MaxNesting
+	}
+	if cfg.TabWidth > 0 {
+		a.defaultTabWidth = cfg.TabWidth
+	}
+	if len(cfg.Languages) > 0 {
+		a.languages, err = newLanguages(cfg.Languages)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
 
-	err = filepath.Walk(
-		opts.CodePath,
-		func(path string, info fs.FileInfo, _ error) error {
-			return ctx.visitPath(opts.CodePath, path, info)
-		},
-	)
+// NewConfig takes the analysis settings out of the command line options, opening the cache if enabled
+func NewConfig(opts *options.Options) (Config, error) {
+	cfg := Config{
+		IncludePatterns:       opts.IncludePatterns,
+		ExcludePatterns:       opts.ExcludePatterns,
+		VerboseLogging:        opts.VerboseLogging,
+		MaxFileSizeBytes:      opts.MaxFileSizeBytes,
+		MaxArchiveDepth:       opts.MaxArchiveDepth,
+		MaxArchiveEntries:     opts.MaxArchiveEntries,
+		MaxArchiveBytes:       opts.MaxArchiveBytes,
+		Languages:             opts.Languages,
+		ExcludeJsxIndentation: opts.ExcludeJsxIndentation,
+		DetectSqlDialects:     opts.DetectSqlDialects,
+		MaxNesting:            opts.MaxNesting,
+		TabWidth:              opts.TabWidth,
+	}
+	if len(opts.CacheDir) > 0 {
+		cache, err := OpenCache(opts.CacheDir, opts.Version, opts.MaxCacheBytes)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Cache = cache
+	}
+	return cfg, nil
+}
+
+func Complexity(opts *options.Options) (*CodeSummary, error) {
+	cfg, err := NewConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Cache != nil {
+		defer func() {
+			hits, misses := cfg.Cache.Stats()
+			log.Printf("cache at %v: %v hits, %v misses", opts.CacheDir, hits, misses)
+		}()
+	}
+	var summary *CodeSummary
+	info, err := os.Stat(opts.CodePath)
+	if err == nil && !info.IsDir() {
+		summary, err = AnalyzeArchive(context.Background(), os.DirFS(filepath.Dir(opts.CodePath)), filepath.Base(opts.CodePath), cfg)
+	} else {
+		summary, err = Analyze(context.Background(), os.DirFS(opts.CodePath), cfg)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to walk files under '%v': %v", opts.CodePath, err)
+		return nil, fmt.Errorf("failed to analyze '%v': %v", opts.CodePath, err)
 	}
+	return summary, nil
+}
 
-	for _, counters := range ctx.CountersByLanguage {
-		counters.Average = counters.Total.average(counters.NumberOfFiles)
+// Analyze walks fsys from its root and summarizes the complexity of every supported source file.
+// The walk stops with ctx.Err() as soon as ctx is done.
+func Analyze(ctx context.Context, fsys fs.FS, cfg Config) (*CodeSummary, error) {
+
+	a, err := newAnalyzerForConfig(fsys, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.walk(ctx, ".", nil)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk files: %v", err)
+	}
+
+	return a.summarize(), nil
+}
+
+// AnalyzeCode counts a single source, given either its language or a path to detect the language from
+func AnalyzeCode(path string, content []byte, language Language) (*FileSummary, error) {
+	return AnalyzeCodeWithLanguages(path, content, language, nil)
+}
+
+// AnalyzeCodeWithLanguages is AnalyzeCode with custom language definitions, see Config.Languages
+func AnalyzeCodeWithLanguages(
+	path string, content []byte, language Language, definitions []LanguageDefinition,
+) (*FileSummary, error) {
+	a, err := newAnalyzerForConfig(nil, Config{Languages: definitions})
+	if err != nil {
+		return nil, err
+	}
+	return a.analyzeCode(path, content, language)
+}
+
+// AnalyzeCodeWithConfig is AnalyzeCode with the languages, tab width and max nesting of cfg, for a source at path on
+// disk, whose tab width is also set by the .editorconfig files of its dir and the dirs above it. Stdin, as path -, is
+// in the working dir.
+func AnalyzeCodeWithConfig(path string, content []byte, language Language, cfg Config) (*FileSummary, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("file path '%v' is not valid: %v", path, err)
+	}
+	root := filepath.VolumeName(absPath) + string(filepath.Separator)
+	relPath, err := filepath.Rel(root, absPath)
+	if err != nil {
+		return nil, fmt.Errorf("file path '%v' is not valid: %v", path, err)
+	}
+	a, err := newAnalyzerForConfig(os.DirFS(root), cfg)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := a.analyzeCode(filepath.ToSlash(relPath), content, language)
+	if err != nil {
+		return nil, err
+	}
+	summary.Path = path
+	return summary, nil
+}
+
+func (a *analyzer) analyzeCode(path string, content []byte, language Language) (*FileSummary, error) {
+	if len(language) == 0 {
+		definition, matched := a.languages.detect(path)
+		if !matched && isScript(path) {
+			definition, matched = a.languages.detectShebang(content)
+		}
+		if !matched {
+			return nil, fmt.Errorf("file '%v' was not mapped to any supported language", path)
+		}
+		language, _ = a.disambiguate(path, content, definition)
+	} else if _, supported := a.languages.byName[language]; !supported {
+		return nil, fmt.Errorf("language '%v' is not supported", language)
 	}
 
-	return &ctx.CodeSummary, nil
+	decoded, err := decode(path, content)
+	if err != nil {
+		return nil, err
+	}
+	definition := a.languages.byName[language]
+	if len(definition.Regions) > 0 {
+		return a.analyzeRegions(path, decoded, definition)
+	} else if definition.Notebook {
+		return a.analyzeNotebook(path, decoded)
+	}
+	counters, err := a.getCountersForCode(decoded, language, a.tabWidth(path, language))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count at %v: %v", path, err)
+	}
+	fileCounters := FileCounters(*counters)
+	summary := &FileSummary{
+		Path:     path,
+		Language: language,
+		Counters: &fileCounters,
+	}
+
+	lines := splitLines(decoded)
+	for _, function := range findFunctions(lines, definition) {
+		functionCode := strings.Join(lines[function.startLine:function.endLine+1], "\n")
+		counters, err := a.getCountersForCode(functionCode, language, a.tabWidth(path, language))
+		if err != nil {
+			return nil, fmt.Errorf("failed to count function %v at %v: %v", function.name, path, err)
+		}
+		functionCounters := FileCounters(*counters)
+		summary.Functions = append(summary.Functions, &FunctionSummary{
+			Name:      function.name,
+			StartLine: function.startLine + 1,
+			EndLine:   function.endLine + 1,
+			Counters:  &functionCounters,
+		})
+	}
+
+	return summary, nil
 }
 
-func (ctx *context) visitPath(rootPath string, path string, info fs.FileInfo) error {
+// analyzeRegions summarizes a file with regions by the counters of every language in it, and all of them together
+func (a *analyzer) analyzeRegions(path string, content string, definition *LanguageDefinition) (*FileSummary, error) {
+	summary := &FileSummary{
+		Path:               path,
+		Language:           definition.Name,
+		Counters:           &FileCounters{},
+		CountersByLanguage: make(map[Language]*FileCounters),
+	}
+	total := &CodeCounters{}
+	for _, region := range a.languages.splitRegions(content, definition) {
+		counters, err := a.getCountersForCode(region.code, region.language, a.tabWidth(path, region.language))
+		if err != nil {
+			return nil, fmt.Errorf("failed to count %v at %v: %v", region.language, path, err)
+		}
+		total.inc(counters)
+		regionCounters := FileCounters(*counters)
+		summary.CountersByLanguage[region.language] = &regionCounters
+	}
+	*summary.Counters = FileCounters(*total)
+	return summary, nil
+}
 
-	if info.IsDir() {
-		if ctx.isExcluded(path) {
-			ctx.verboseLog("--- dir '%v' is excluded by patterns", path)
-			return filepath.SkipDir
+// walk visits all files under root, calling onDir for every dir that is not excluded
+func (a *analyzer) walk(ctx context.Context, root string, onDir func(path string) error) error {
+	return fs.WalkDir(
+		a.fsys,
+		root,
+		func(path string, entry fs.DirEntry, walkErr error) error {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			if walkErr != nil {
+				if path == root {
+					return walkErr
+				}
+				// e.g. a dir without read permission, which is skipped rather than failing the whole walk
+				log.Printf("failed to read '%v', skipping it: %v", path, walkErr)
+				return nil
+			}
+			err := a.visitPath(ctx, path, entry)
+			if err == nil && entry.IsDir() && onDir != nil {
+				err = onDir(path)
+			}
+			return err
+		},
+	)
+}
+
+func (a *analyzer) summarize() *CodeSummary {
+	for _, counters := range a.CountersByLanguage {
+		counters.Average = counters.Total.average(counters.NumberOfFiles)
+	}
+	return &a.CodeSummary
+}
+
+func (a *analyzer) visitPath(ctx context.Context, path string, entry fs.DirEntry) error {
+
+	if entry.IsDir() {
+		if path != "." && a.isExcluded(path) {
+			a.verboseLog("--- dir '%v' is excluded by patterns", path)
+			return fs.SkipDir
 		}
 		return nil
 	}
-	if !info.Mode().IsRegular() {
-		ctx.verboseLog("--- file '%v' is not regular", path)
+	if !entry.Type().IsRegular() {
+		a.verboseLog("--- file '%v' is not regular", path)
+		return nil
+	}
+	info, err := entry.Info()
+	if err != nil {
+		return fmt.Errorf("failed to stat %v: %v", path, err)
+	}
+
+	if isArchive(path) {
+		return a.visitNestedArchive(ctx, path, info.Size(), func() (io.ReadCloser, error) {
+			return a.fsys.Open(path)
+		}, 0)
+	}
+
+	return a.visitFile(path, info.Size(), func() (io.ReadCloser, error) {
+		return a.fsys.Open(path)
+	})
+}
+
+// visitFile counts a single file by its path and declared size, open is only called for supported files
+func (a *analyzer) visitFile(path string, size int64, open func() (io.ReadCloser, error)) error {
+
+	if a.maxFileSizeBytes > 0 && size > a.maxFileSizeBytes {
+		a.verboseLog("--- file '%v' is too large (%v MB)", path, size/(1024*1024))
 		return nil
 	}
-	if info.Size() > ctx.maxFileSizeBytes {
-		ctx.verboseLog("--- file '%v' is too large (%v MB)", path, info.Size()/(1024*1024))
+
+	definition, matched := a.languages.detect(path)
+	if !matched && !isScript(path) {
+		a.verboseLog("--- file '%v' was not mapped to any supported language", path)
 		return nil
 	}
 
-	fileExtension := filepath.Ext(path)
-	language, matched := tryGetLanguage(fileExtension)
-	if !matched {
-		ctx.verboseLog("--- file '%v' was not mapped to any supported language", path)
+	if a.isExcluded(path) || !a.isIncluded(path) {
+		a.verboseLog("--- file '%v' is not matching patterns", path)
 		return nil
 	}
 
-	relativePath, err := filepath.Rel(rootPath, path)
+	var fileBytes []byte
+	var err error
+	if matched {
+		fileBytes, err = a.readFile(path, open)
+	} else {
+		definition, fileBytes, err = a.readScript(path, open)
+	}
+	if errors.Is(err, errFileTooLarge) {
+		a.verboseLog("--- file '%v' is too large (over %v MB)", path, a.maxFileSizeBytes/(1024*1024))
+		return nil
+	}
 	if err != nil {
-		return fmt.Errorf("failed to relativize path %v: %v", path, err)
+		return err
 	}
-	if ctx.isExcluded(relativePath) || !ctx.isIncluded(relativePath) {
-		ctx.verboseLog("--- file '%v' is not matching patterns", path)
+	if definition == nil {
+		a.verboseLog("--- file '%v' was not mapped to any supported language", path)
 		return nil
 	}
+	language := definition.Name
+
+	if disambiguated, reason := a.disambiguate(path, fileBytes, definition); len(reason) > 0 {
+		a.verboseLog("~~~ file '%v' is %v by %v", path, disambiguated, reason)
+		language = disambiguated
+	}
 
-	fileCounters, err := ctx.getCountersForPath(path, language)
+	if definition := a.languages.byName[language]; len(definition.Regions) > 0 {
+		return a.visitRegions(path, fileBytes, definition)
+	} else if definition.Notebook {
+		return a.visitNotebook(path, fileBytes)
+	}
+
+	fileCounters, err := a.getCountersForBytes(path, fileBytes, language)
 	if err != nil {
-		return fmt.Errorf("failed to count at %v: %v", path, err)
+		return err
 	}
-	ctx.verboseLog("+++ '%v': %v", path, fileCounters)
+	a.verboseLog("+++ '%v': %v", path, fileCounters)
 
-	summaryCounters, found := ctx.CountersByLanguage[language]
-	if !found {
-		summaryCounters = &SummaryCounters{
-			Total:   &CodeCounters{},
-			Average: &CodeCounters{},
-		}
-		ctx.CountersByLanguage[language] = summaryCounters
+	a.add(path, language, fileCounters)
+
+	return nil
+}
+
+// visitRegions counts the code of every language in a file with regions, e.g. vue
+func (a *analyzer) visitRegions(path string, fileBytes []byte, definition *LanguageDefinition) error {
+	content, err := decode(path, fileBytes)
+	if err != nil {
+		return err
 	}
-	summaryCounters.Total.inc(fileCounters)
-	summaryCounters.NumberOfFiles++
+	for _, region := range a.languages.splitRegions(content, definition) {
+		code := region.code
+		regionCounters, err := a.getCachedCounters(path, []byte(code), region.language, func() (string, error) {
+			return code, nil
+		})
+		if err != nil {
+			return err
+		}
+		a.verboseLog("+++ '%v' %v: %v", path, region.language, regionCounters)
 
+		a.add(path, region.language, regionCounters)
+	}
 	return nil
 }
 
-func (ctx *context) getCountersForPath(path string, language Language) (*CodeCounters, error) {
-	content, err := ctx.readFile(path)
+func (a *analyzer) getCountersForBytes(path string, fileBytes []byte, language Language) (*CodeCounters, error) {
+	return a.getCachedCounters(path, fileBytes, language, func() (string, error) {
+		return decode(path, fileBytes)
+	})
+}
+
+// getCachedCounters counts the content of the given bytes, unless they were counted before
+func (a *analyzer) getCachedCounters(
+	path string, fileBytes []byte, language Language, decode func() (string, error),
+) (*CodeCounters, error) {
+	var cacheKey string
+	if a.cache != nil {
+		cacheKey = a.cache.key(fileBytes, language, a.countingHash(path, language))
+		if counters, found := a.cache.get(cacheKey); found {
+			return counters, nil
+		}
+	}
+
+	content, err := decode()
 	if err != nil {
 		return nil, err
 	}
-	return ctx.getCountersForCode(content, language)
+	fileCounters, err := a.getCountersForCode(content, language, a.tabWidth(path, language))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count at %v: %v", path, err)
+	}
+
+	if a.cache != nil {
+		err = a.cache.put(cacheKey, fileCounters)
+		if err != nil {
+			a.verboseLog("--- failed to cache '%v': %v", path, err)
+		}
+	}
+	return fileCounters, nil
+}
+
+// summaryLanguages are the language of a file and its rollup, if any
+func (a *analyzer) summaryLanguages(language Language) []Language {
+	if definition, found := a.languages.byName[language]; found && len(definition.Rollup) > 0 {
+		return []Language{language, definition.Rollup}
+	}
+	return []Language{language}
+}
+
+// countingHash changes whenever the counters of a file in the language may change, other than by its content
+func (a *analyzer) countingHash(path string, language Language) string {
+	return fmt.Sprintf(
+		"%v/jsx=%v/nesting=%v/tab=%v",
+		a.languages.hashes[language], a.excludeJsxIndentation, a.maxNesting, a.tabWidth(path, language),
+	)
+}
+
+// tabWidth is the columns of a tab in a file, by the .editorconfig files above it, its language or the tab-width flag
+func (a *analyzer) tabWidth(path string, language Language) int {
+	if width := a.editorconfigTabWidth(path); width > 0 {
+		return width
+	}
+	if definition, found := a.languages.byName[language]; found && definition.TabWidth > 0 {
+		return definition.TabWidth
+	}
+	return a.defaultTabWidth
+}
+
+func (a *analyzer) add(path string, language Language, fileCounters *CodeCounters) {
+	for _, summaryLanguage := range a.summaryLanguages(language) {
+		summaryCounters, found := a.CountersByLanguage[summaryLanguage]
+		if !found {
+			summaryCounters = &SummaryCounters{
+				Total:   &CodeCounters{},
+				Average: &CodeCounters{},
+			}
+			a.CountersByLanguage[summaryLanguage] = summaryCounters
+		}
+		summaryCounters.Total.inc(fileCounters)
+		summaryCounters.NumberOfFiles++
+	}
+
+	if a.files != nil {
+		a.files[path] = append(a.files[path], &fileResult{language: language, counters: fileCounters})
+	}
+}
+
+// remove takes back the counters of the file at path, or of all files under it
+func (a *analyzer) remove(path string) {
+	for filePath, results := range a.files {
+		if path != "." && filePath != path && !strings.HasPrefix(filePath, path+"/") {
+			continue
+		}
+		delete(a.files, filePath)
+		for _, file := range results {
+			for _, summaryLanguage := range a.summaryLanguages(file.language) {
+				summaryCounters := a.CountersByLanguage[summaryLanguage]
+				summaryCounters.Total.dec(file.counters)
+				summaryCounters.NumberOfFiles--
+				if summaryCounters.NumberOfFiles == 0 {
+					delete(a.CountersByLanguage, summaryLanguage)
+				}
+			}
+		}
+		a.verboseLog("--- '%v' was removed", filePath)
+	}
 }
 
-func (ctx *context) getCountersForCode(content string, language Language) (*CodeCounters, error) {
+func (a *analyzer) getCountersForCode(content string, language Language, tabWidth int) (*CodeCounters, error) {
+	definition, found := a.languages.byName[language]
+	if !found {
+		return nil, fmt.Errorf("language '%v' is not supported", language)
+	}
 
-	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	lines := splitLines(content)
+	keywords := newKeywordMatcher(definition)
+	operators := newOperatorMatcher(definition)
+	nesting := newNestingCounter(definition)
+	style := &indentationStyle{}
+	continuations := newContinuationTracker(definition)
 
 	counters := &CodeCounters{}
 
 	minIndentation := float64(0)
 	prevIndentation := float64(-1)
-	expectEndingComment := ""
+	var openBlockComment *BlockComment
+	blockCommentDepth := 0
+	heredocEnd := ""
+	// hereStringEnd starts the line ending a here-string, which may go on after it, e.g. "@ | Set-Content
+	hereStringEnd := ""
 	for _, line := range lines {
 		counters.Lines++
 
-		if len(expectEndingComment) > 0 {
+		if len(heredocEnd) > 0 || len(hereStringEnd) > 0 {
+			// a document, not code structure
+			cleanLine := strings.TrimSpace(line)
+			if len(heredocEnd) > 0 && cleanLine == heredocEnd {
+				heredocEnd = ""
+			} else if len(hereStringEnd) > 0 && strings.HasPrefix(cleanLine, hereStringEnd) {
+				hereStringEnd = ""
+			}
+			if len(cleanLine) > 0 {
+				counters.LinesOfCode++
+			}
+			continue
+		}
+
+		if isColumnComment(line, definition.ColumnComments) {
+			continue
+		}
+		if definition.MarginColumns > 0 {
+			line = cutMargin(line, definition.MarginColumns)
+		}
+
+		if openBlockComment != nil {
 			// in comment block
-			endCommentIndex := strings.Index(line, expectEndingComment)
+			var endCommentIndex int
+			endCommentIndex, blockCommentDepth = findBlockCommentEnd(line, openBlockComment, blockCommentDepth)
 			if endCommentIndex == -1 {
 				continue
 			} else {
 				// comment block ended on this line
-				line = strings.TrimSpace(line[(endCommentIndex + len(expectEndingComment)):])
-				expectEndingComment = ""
+				line = strings.TrimSpace(line[endCommentIndex:])
+				openBlockComment = nil
 			}
 		}
 
@@ -153,39 +621,31 @@ func (ctx *context) getCountersForCode(content string, language Language) (*Code
 			continue
 		}
 
-		if strings.HasPrefix(cleanLine, "//") || strings.HasPrefix(cleanLine, "#") {
-			// single line comment
+		commentIndex, blockComment := findBlockCommentStart(cleanLine, definition)
+		if commentIndex != 0 && hasAnyPrefix(cleanLine, definition.LineComments) {
+			// single line comment, unless it is the start of a block comment, e.g. %{ in matlab
 			continue
 		}
 
-		const pythonMultilineString = "\"\"\""
 		postCommentLine := ""
-		if isStartOfMultiLineComment(cleanLine) {
-			expectEndingComment = "*/"
-			commentIndex := strings.Index(cleanLine, "/*")
-			postCommentLine = strings.TrimSpace(cleanLine[2+commentIndex:])
-			cleanLine = strings.TrimSpace(cleanLine[:commentIndex])
-		} else if language == "python" && strings.Contains(cleanLine, pythonMultilineString) {
-			expectEndingComment = pythonMultilineString
-			commentIndex := strings.Index(cleanLine, pythonMultilineString)
-			postCommentLine = strings.TrimSpace(cleanLine[len(pythonMultilineString)+commentIndex:])
+		if blockComment != nil {
+			openBlockComment, blockCommentDepth = blockComment, 1
+			postCommentLine = strings.TrimSpace(cleanLine[len(blockComment.Start)+commentIndex:])
 			cleanLine = strings.TrimSpace(cleanLine[:commentIndex])
-		} else if language == "ruby" && strings.HasPrefix(cleanLine, "=begin") {
-			expectEndingComment = "=end"
-			continue
-		} else if language == "ruby" && strings.HasPrefix(cleanLine, "<<-DOC") {
-			expectEndingComment = "DOC"
-			continue
 		}
 
+		// the code around a comment in the line, e.g. ) { after f(x /* y */
+		codeLine := cleanLine
 		if len(postCommentLine) > 0 {
 			// in comment block
-			endCommentIndex := strings.Index(postCommentLine, expectEndingComment)
+			var endCommentIndex int
+			endCommentIndex, blockCommentDepth = findBlockCommentEnd(postCommentLine, openBlockComment, blockCommentDepth)
 			if endCommentIndex == -1 {
 				continue
 			} else {
 				// comment block ended on this line
-				expectEndingComment = ""
+				openBlockComment = nil
+				codeLine = strings.TrimSpace(cleanLine + " " + postCommentLine[endCommentIndex:])
 			}
 		}
 
@@ -195,8 +655,30 @@ func (ctx *context) getCountersForCode(content string, language Language) (*Code
 
 		counters.LinesOfCode++
 
-		indentation := float64(len(line) - len(trimSpaceLeft(line)))
-		if indentation > 0 {
+		// lines wrapped from the line before them are indented by alignment, not by nesting, unlike jsx elements, see
+		// the exclude-jsx-indentation flag
+		jsx := definition.Jsx && jsxElementPattern.MatchString(cleanLine)
+		continuation := continuations.isContinuation(codeLine) && !jsx
+		leadingSpace := line[:len(line)-len(trimSpaceLeft(line))]
+		if continuation {
+			counters.ContinuationLines++
+		} else if style.isMixed(leadingSpace) {
+			counters.MixedIndentationLines++
+		}
+
+		if a.excludeJsxIndentation && jsx {
+			// markup nesting is not code complexity
+			counters.Keywords += keywords.count(cleanLine)
+			counters.Operators += operators.count(cleanLine)
+			if definition.Braces {
+				// the braces of jsx expressions still open and close blocks
+				nesting.lineDepth(cleanLine, 0, continuation)
+			}
+			continue
+		}
+
+		indentation := float64(indentationWidth(leadingSpace, tabWidth))
+		if indentation > 0 && !continuation {
 			counters.Indentations += indentation
 			if minIndentation == 0 || indentation < minIndentation {
 				minIndentation = indentation
@@ -209,9 +691,25 @@ func (ctx *context) getCountersForCode(content string, language Language) (*Code
 			}
 		}
 
-		prevIndentation = indentation
+		if !continuation {
+			prevIndentation = indentation
+		}
+		counters.addNesting(nesting.lineDepth(cleanLine, int(indentation), continuation), a.maxNesting)
+
+		counters.Keywords += keywords.count(cleanLine)
+		counters.Operators += operators.count(cleanLine)
 
-		counters.Keywords += countKeywords(cleanLine, language)
+		if definition.Heredocs && !strings.Contains(cleanLine, "((") {
+			// not in arithmetic, e.g. $((x << y))
+			if match := heredocPattern.FindStringSubmatch(cleanLine); match != nil {
+				heredocEnd = match[2]
+			}
+		}
+		for _, hereString := range definition.HereStrings {
+			if strings.HasSuffix(cleanLine, hereString.Start) {
+				hereStringEnd = hereString.End
+			}
+		}
 	}
 
 	if minIndentation > 0 {
@@ -219,35 +717,191 @@ func (ctx *context) getCountersForCode(content string, language Language) (*Code
 		counters.IndentationsDiffNormalized = counters.IndentationsDiff / minIndentation
 	}
 
+	if counters.MixedIndentationLines > 0 {
+		counters.MixedIndentation = 1
+	}
+
 	counters.IndentationsComplexity = safeDivide(counters.IndentationsNormalized, counters.LinesOfCode)
 	counters.IndentationsDiffComplexity = safeDivide(counters.IndentationsDiffNormalized, counters.LinesOfCode)
 	counters.KeywordsComplexity = safeDivide(counters.Keywords, counters.LinesOfCode)
+	counters.OperatorsComplexity = safeDivide(counters.Operators, counters.LinesOfCode)
 
 	return counters, nil
 }
 
-func isStartOfMultiLineComment(cleanLine string) bool {
-	_, after, found := strings.Cut(cleanLine, "/*")
+func splitLines(content string) []string {
+	return strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+}
 
-	if !found {
+// jsxElementPattern matches lines starting with a jsx tag, or ending a self-closing one, e.g. <div>, </Button>, <>, or
+// />, but not a > alone, which may close the arguments of a generic type too
+var jsxElementPattern = regexp.MustCompile(`^(</?[A-Za-z][\w.:-]*(\s|/?>|$)|</?>|/>$)`)
+
+// heredocPattern matches the start of a heredoc, e.g. <<EOF, <<-'EOF' or <<"EOF", but not a <<< here string
+var heredocPattern = regexp.MustCompile(`(^|[^<])<<[-~]?\s*(?:'|")?([A-Za-z_]\w*)`)
+
+func hasAnyPrefix(line string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isColumnComment is whether the line has a comment marker at its column
+func isColumnComment(line string, columnComments []ColumnComment) bool {
+	for _, columnComment := range columnComments {
+		if len(line) >= columnComment.Column && hasAnyPrefix(line[columnComment.Column-1:], columnComment.Markers) {
+			return true
+		}
+	}
+	return false
+}
+
+// cutMargin is the line without its first columns
+func cutMargin(line string, columns int) string {
+	if len(line) <= columns {
+		return ""
+	}
+	return line[columns:]
+}
+
+// findBlockCommentStart is the first block comment start of the line that is not in a string, if any
+func findBlockCommentStart(cleanLine string, definition *LanguageDefinition) (int, *BlockComment) {
+	for i := 0; i < len(cleanLine); i++ {
+		for j := range definition.BlockComments {
+			blockComment := &definition.BlockComments[j]
+			if blockComment.LineStart && i > 0 || blockComment.OwnLine && cleanLine != blockComment.Start {
+				continue
+			}
+			if startsBlockComment(cleanLine, i, blockComment) {
+				return i, blockComment
+			}
+		}
+		if delimiter := stringDelimiterAt(cleanLine, i, definition.StringDelimiters, definition.CharLiterals); len(delimiter) > 0 {
+			i = skipString(cleanLine, i, delimiter)
+		}
+	}
+	return -1, nil
+}
+
+// findBlockCommentEnd is the index after the end of the block comment, at the given depth of nested comments, or -1
+// with the depth at the end of the line
+func findBlockCommentEnd(line string, blockComment *BlockComment, depth int) (int, int) {
+	if blockComment.OwnLine {
+		switch strings.TrimSpace(line) {
+		case blockComment.End:
+			depth--
+			if depth == 0 || !blockComment.Nested {
+				return len(line), 0
+			}
+		case blockComment.Start:
+			if blockComment.Nested {
+				depth++
+			}
+		}
+		return -1, depth
+	}
+	if !blockComment.Nested {
+		endIndex := strings.Index(line, blockComment.End)
+		if endIndex == -1 {
+			return -1, depth
+		}
+		return endIndex + len(blockComment.End), 0
+	}
+	for i := 0; i < len(line); {
+		if strings.HasPrefix(line[i:], blockComment.End) {
+			i += len(blockComment.End)
+			depth--
+			if depth == 0 {
+				return i, 0
+			}
+		} else if startsBlockComment(line, i, blockComment) {
+			i += len(blockComment.Start)
+			depth++
+		} else {
+			i++
+		}
+	}
+	return -1, depth
+}
+
+// startsBlockComment is whether the start of the block comment is at i, and not part of something else
+func startsBlockComment(line string, i int, blockComment *BlockComment) bool {
+	if !strings.HasPrefix(line[i:], blockComment.Start) {
 		return false
 	}
+	after := line[i+len(blockComment.Start):]
+	// e.g. a "/*" string, a /*.go glob or the (*) operator of ocaml
+	return !(len(after) > 1 && strings.ContainsAny(after[0:1], "'\".") || strings.HasPrefix(after, ")"))
+}
 
-	if len(after) > 1 {
-		nextChar := after[0:1]
-		if strings.ContainsAny(nextChar, "'\".") {
-			return false
+// skipString is the index of the delimiter closing the string that starts at i, or the end of the line
+func skipString(line string, i int, delimiter string) int {
+	for j := i + len(delimiter); j < len(line); j++ {
+		if line[j] == '\\' {
+			j++
+		} else if strings.HasPrefix(line[j:], delimiter) {
+			return j + len(delimiter) - 1
 		}
 	}
-	return true
+	return len(line)
+}
+
+var errFileTooLarge = errors.New("file is too large")
+
+func (a *analyzer) readFile(path string, open func() (io.ReadCloser, error)) ([]byte, error) {
+	file, err := open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file at '%v': %v", path, err)
+	}
+	defer file.Close()
+
+	return a.readAll(path, file)
+}
+
+// maxShebangLength is how much of a file without extension is read to find a shebang
+const maxShebangLength = 256
+
+// readScript reads a file without extension if its shebang names the interpreter of a language, otherwise returns
+// no definition, after reading only its first line
+func (a *analyzer) readScript(path string, open func() (io.ReadCloser, error)) (*LanguageDefinition, []byte, error) {
+	file, err := open()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open file at '%v': %v", path, err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(file, maxShebangLength)
+	firstBytes, _ := reader.Peek(maxShebangLength)
+	definition, found := a.languages.detectShebang(firstBytes)
+	if !found {
+		return nil, nil, nil
+	}
+	a.verboseLog("~~~ file '%v' is %v by its shebang", path, definition.Name)
+	fileBytes, err := a.readAll(path, reader)
+	return definition, fileBytes, err
 }
 
-func (ctx *context) readFile(path string) (string, error) {
-	fileBytes, err := os.ReadFile(path)
+func (a *analyzer) readAll(path string, file io.Reader) ([]byte, error) {
+	reader := file
+	if a.maxFileSizeBytes > 0 {
+		// declared sizes may lie, e.g. in archives, so never read more than the limit
+		reader = io.LimitReader(file, a.maxFileSizeBytes+1)
+	}
+	fileBytes, err := io.ReadAll(reader)
 	if err != nil {
-		return "", fmt.Errorf("failed to open file at '%v': %v", path, err)
+		return nil, fmt.Errorf("failed to read file at '%v': %w", path, err)
 	}
+	if a.maxFileSizeBytes > 0 && int64(len(fileBytes)) > a.maxFileSizeBytes {
+		return nil, errFileTooLarge
+	}
+
+	return fileBytes, nil
+}
 
+func decode(path string, fileBytes []byte) (string, error) {
 	encoding, encodingName, _ := charset.DetermineEncoding(fileBytes, "")
 
 	decodedBytes, err := encoding.NewDecoder().Bytes(fileBytes)
@@ -258,22 +912,22 @@ func (ctx *context) readFile(path string) (string, error) {
 	return string(decodedBytes), nil
 }
 
-func (ctx *context) isExcluded(path string) bool {
-	if len(ctx.excludePatterns) > 0 && matches(path, ctx.excludePatterns) {
+func (a *analyzer) isExcluded(path string) bool {
+	if len(a.excludePatterns) > 0 && matches(path, a.excludePatterns) {
 		return true
 	}
 	return false
 }
 
-func (ctx *context) isIncluded(path string) bool {
-	if len(ctx.includePatterns) == 0 || matches(path, ctx.includePatterns) {
+func (a *analyzer) isIncluded(path string) bool {
+	if len(a.includePatterns) == 0 || matches(path, a.includePatterns) {
 		return true
 	}
 	return false
 }
 
-func (ctx *context) verboseLog(format string, v ...interface{}) {
-	if ctx.verboseLogging {
+func (a *analyzer) verboseLog(format string, v ...interface{}) {
+	if a.verboseLogging {
 		log.Printf(format, v...)
 	}
 }
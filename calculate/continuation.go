@@ -0,0 +1,187 @@
+package calculate
+
+import (
+	"regexp"
+	"strings"
+)
+
+// leadingContinuations start lines that continue the expression of the line before them, e.g. a method chain
+var leadingContinuations = []string{".", "?.", "&&", "||", "|>", "? "}
+
+// trailingContinuations end lines whose expression goes on in the next line, e.g. a condition wrapped after &&
+var trailingContinuations = []string{"&&", "||", "+", "-", " ?", "??", "?:", "\\"}
+
+// braceTrailingContinuations end lines whose expression goes on in the next line in languages with brace blocks, in
+// others they also end the heads of blocks, e.g. = of a function in haskell or . of a clause in erlang
+var braceTrailingContinuations = []string{"=", "."}
+
+// commandTrailingContinuations end lines whose command goes on in the next line in languages of commands, where other
+// operators are arguments, e.g. cd -
+var commandTrailingContinuations = []string{"\\", "&&", "||", "|"}
+
+// definitionHeadPattern matches the heads of definitions whose body follows their =, which is a block rather than a
+// wrapped expression, e.g. def f(): Int = in scala or fun f() = in kotlin
+var definitionHeadPattern = regexp.MustCompile(`^(\w+\s+)*(def|fun)\s|\)\s*(:[^=]*)?=$`)
+
+// continuationTracker tells the lines that continue the statement of the lines before them rather than nest in a
+// block, e.g. the arguments of a call wrapped in several lines, which are indented by alignment rather than by nesting
+type continuationTracker struct {
+	definition *LanguageDefinition
+	disabled   bool
+	// literalBraces are of dicts and sets rather than blocks, e.g. in python
+	literalBraces bool
+	trailing      []string
+	// open are the brackets open after the last line, innermost last, ( for any bracket of an expression
+	open []byte
+	// continued is whether the last line ends by continuing on the next one, e.g. by a trailing && or \
+	continued bool
+}
+
+func newContinuationTracker(definition *LanguageDefinition) *continuationTracker {
+	c := &continuationTracker{
+		definition:    definition,
+		disabled:      definition.NoContinuations,
+		literalBraces: languageToBlockStyle[definition.Name] == indentationBlocks,
+		trailing:      trailingContinuations,
+	}
+	if definition.Commands {
+		c.trailing = commandTrailingContinuations
+	} else if definition.Braces {
+		c.trailing = append(append([]string{}, trailingContinuations...), braceTrailingContinuations...)
+	}
+	return c
+}
+
+// isContinuation is whether the line continues the lines before it, by a bracket they left open, an operator they end
+// with or a leading operator, e.g. .filter() of a method chain
+func (c *continuationTracker) isContinuation(cleanLine string) bool {
+	if c.disabled {
+		return false
+	}
+	code := strings.TrimSpace(stripStringsAndComments(cleanLine, c.definition))
+	continuation := c.continued || c.inBrackets() && !c.closesBlock(code) && !c.closesBrackets(code) ||
+		startsWithOperator(code, leadingContinuations)
+
+	if c.opensBlockParenthesis(code) {
+		c.open = append(c.open, '{')
+		c.continued = false
+		return continuation
+	}
+	for i := 0; i < len(code); i++ {
+		switch code[i] {
+		case '(', '[':
+			c.open = append(c.open, '(')
+		case '{':
+			if c.literalBraces {
+				c.open = append(c.open, '(')
+			} else {
+				c.open = append(c.open, '{')
+			}
+		case ')', ']':
+			if len(c.open) > 0 {
+				c.open = c.open[:len(c.open)-1]
+			}
+		case '}':
+			// also closes the brackets left open in the block, e.g. by a missing )
+			for c.inBrackets() && c.hasOpenBlock() {
+				c.open = c.open[:len(c.open)-1]
+			}
+			if len(c.open) > 0 {
+				c.open = c.open[:len(c.open)-1]
+			}
+		}
+	}
+	c.continued = c.endsWithContinuation(code)
+	return continuation
+}
+
+// opensBlockParenthesis is whether the ( ending the line opens a block rather than wrapped arguments, e.g. import ( in go
+func (c *continuationTracker) opensBlockParenthesis(code string) bool {
+	for _, keyword := range c.definition.BlockParentheses {
+		rest := strings.TrimPrefix(code, keyword)
+		if len(rest) < len(code) && strings.TrimSpace(rest) == "(" {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *continuationTracker) inBrackets() bool {
+	return len(c.open) > 0 && c.open[len(c.open)-1] == '('
+}
+
+// closesBlock is whether the line starts by closing a block rather than a bracket of an expression, e.g. }
+func (c *continuationTracker) closesBlock(code string) bool {
+	return strings.HasPrefix(code, "}") && !c.literalBraces && c.hasOpenBlock()
+}
+
+// closesBrackets is whether the line starts by closing every bracket left open since the statement started, which puts
+// it back at the indentation of the statement, e.g. ); after wrapped arguments
+func (c *continuationTracker) closesBrackets(code string) bool {
+	brackets := ")]"
+	if c.literalBraces {
+		brackets = ")]}"
+	}
+	closing := len(code) - len(strings.TrimLeft(code, brackets))
+	if closing == 0 {
+		return false
+	}
+	open := 0
+	for i := len(c.open) - 1; i >= 0 && c.open[i] == '('; i-- {
+		open++
+	}
+	return closing >= open
+}
+
+func (c *continuationTracker) hasOpenBlock() bool {
+	for _, bracket := range c.open {
+		if bracket == '{' {
+			return true
+		}
+	}
+	return false
+}
+
+// endsWithContinuation is whether the line ends with an operator continuing on the next line, except the = of the head
+// of a definition, whose body is a block
+func (c *continuationTracker) endsWithContinuation(code string) bool {
+	for _, operator := range c.trailing {
+		if endsWithOperator(code, operator) {
+			return operator != "=" || !definitionHeadPattern.MatchString(code)
+		}
+	}
+	return false
+}
+
+// endsWithOperator is whether the operator is the last token of the code, rather than the end of another operator,
+// e.g. - of -- or = of ==
+func endsWithOperator(code string, operator string) bool {
+	if !strings.HasSuffix(code, operator) {
+		return false
+	}
+	before := len(code) - len(operator)
+	return operator == "\\" || before == 0 || !isOperatorChar(code[before-1])
+}
+
+// startsWithOperator is whether the code starts with any of the operators as a token, . and ?. followed by a name,
+// e.g. not ... or .5
+func startsWithOperator(code string, operators []string) bool {
+	for _, operator := range operators {
+		if !strings.HasPrefix(code, operator) || len(code) == len(operator) {
+			continue
+		}
+		next := code[len(operator)]
+		if strings.HasSuffix(operator, ".") {
+			if next == '_' || next >= 'a' && next <= 'z' || next >= 'A' && next <= 'Z' {
+				return true
+			}
+		} else if !isOperatorChar(next) {
+			return true
+		}
+	}
+	return false
+}
+
+func isOperatorChar(c byte) bool {
+	return strings.IndexByte("+-*/%=<>!&|^~?:.\\", c) >= 0
+}
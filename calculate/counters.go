@@ -16,26 +16,132 @@ type CodeCounters struct {
 	Lines                      float64 `json:"-"`
 	LinesOfCode                float64 `json:"lines_of_code"`
 	Keywords                   float64 `json:"-"`
+	Operators                  float64 `json:"-"`
 	Indentations               float64 `json:"-"`
 	IndentationsNormalized     float64 `json:"-"`
 	IndentationsDiff           float64 `json:"-"`
 	IndentationsDiffNormalized float64 `json:"-"`
 	KeywordsComplexity         float64 `json:"keywords_complexity"`
+	OperatorsComplexity        float64 `json:"operators_complexity"`
 	IndentationsComplexity     float64 `json:"indentations_complexity"`
 	IndentationsDiffComplexity float64 `json:"indentations_diff_complexity"`
+	// MaxNesting is the deepest nesting of a line of code, of all the files rather than summed or averaged over them
+	MaxNesting float64 `json:"max_nesting"`
+	// DeepLines are the lines of code nested deeper than the max-nesting flag
+	DeepLines float64 `json:"deep_lines"`
+	// NestingHistogram is the number of lines of code at every nesting depth, from the top level
+	NestingHistogram []float64 `json:"nesting_histogram"`
+	// MixedIndentation is 1 for a file indented by both tabs and spaces, summed to the number of such files
+	MixedIndentation      float64 `json:"mixed_indentation"`
+	MixedIndentationLines float64 `json:"mixed_indentation_lines"`
+	// ContinuationLines continue the line before them, e.g. wrapped arguments, and are left out of the indentations
+	ContinuationLines float64 `json:"continuation_lines"`
+}
+
+// FileSummary holds the counters of a single source, including the raw counts that are only summarized for directories
+type FileSummary struct {
+	Path      string             `json:"path,omitempty"`
+	Language  Language           `json:"language"`
+	Counters  *FileCounters      `json:"counters"`
+	Functions []*FunctionSummary `json:"functions,omitempty"`
+	// CountersByLanguage are the counters of every language in a file with regions, e.g. vue
+	CountersByLanguage map[Language]*FileCounters `json:"counters_by_language,omitempty"`
+	// Cells are the counters of every code cell of a notebook
+	Cells []*CellSummary `json:"cells,omitempty"`
+}
+
+// FunctionSummary holds the counters of a single function in a file, by 1-based line numbers
+type FunctionSummary struct {
+	Name      string        `json:"name"`
+	StartLine int           `json:"start_line"`
+	EndLine   int           `json:"end_line"`
+	Counters  *FileCounters `json:"counters"`
+}
+
+// CellSummary holds the counters of a single code cell of a notebook, by its 1-based index among all cells
+type CellSummary struct {
+	Cell     int           `json:"cell"`
+	Counters *FileCounters `json:"counters"`
+}
+
+// FileCounters has the same fields as CodeCounters, all serialized
+type FileCounters struct {
+	Lines                      float64   `json:"lines"`
+	LinesOfCode                float64   `json:"lines_of_code"`
+	Keywords                   float64   `json:"keywords"`
+	Operators                  float64   `json:"operators"`
+	Indentations               float64   `json:"indentations"`
+	IndentationsNormalized     float64   `json:"indentations_normalized"`
+	IndentationsDiff           float64   `json:"indentations_diff"`
+	IndentationsDiffNormalized float64   `json:"indentations_diff_normalized"`
+	KeywordsComplexity         float64   `json:"keywords_complexity"`
+	OperatorsComplexity        float64   `json:"operators_complexity"`
+	IndentationsComplexity     float64   `json:"indentations_complexity"`
+	IndentationsDiffComplexity float64   `json:"indentations_diff_complexity"`
+	MaxNesting                 float64   `json:"max_nesting"`
+	DeepLines                  float64   `json:"deep_lines"`
+	NestingHistogram           []float64 `json:"nesting_histogram"`
+	MixedIndentation           float64   `json:"mixed_indentation"`
+	MixedIndentationLines      float64   `json:"mixed_indentation_lines"`
+	ContinuationLines          float64   `json:"continuation_lines"`
 }
 
 func (counters *CodeCounters) inc(other *CodeCounters) {
 	counters.Lines += other.Lines
 	counters.LinesOfCode += other.LinesOfCode
 	counters.Keywords += other.Keywords
+	counters.Operators += other.Operators
 	counters.Indentations += other.Indentations
 	counters.IndentationsNormalized += other.IndentationsNormalized
 	counters.IndentationsDiff += other.IndentationsDiff
 	counters.IndentationsDiffNormalized += other.IndentationsDiffNormalized
 	counters.KeywordsComplexity += other.KeywordsComplexity
+	counters.OperatorsComplexity += other.OperatorsComplexity
 	counters.IndentationsComplexity += other.IndentationsComplexity
 	counters.IndentationsDiffComplexity += other.IndentationsDiffComplexity
+	if other.MaxNesting > counters.MaxNesting {
+		counters.MaxNesting = other.MaxNesting
+	}
+	counters.DeepLines += other.DeepLines
+	counters.MixedIndentation += other.MixedIndentation
+	counters.MixedIndentationLines += other.MixedIndentationLines
+	counters.ContinuationLines += other.ContinuationLines
+	for len(counters.NestingHistogram) < len(other.NestingHistogram) {
+		counters.NestingHistogram = append(counters.NestingHistogram, 0)
+	}
+	for depth, lines := range other.NestingHistogram {
+		counters.NestingHistogram[depth] += lines
+	}
+}
+
+func (counters *CodeCounters) dec(other *CodeCounters) {
+	counters.Lines -= other.Lines
+	counters.LinesOfCode -= other.LinesOfCode
+	counters.Keywords -= other.Keywords
+	counters.Operators -= other.Operators
+	counters.Indentations -= other.Indentations
+	counters.IndentationsNormalized -= other.IndentationsNormalized
+	counters.IndentationsDiff -= other.IndentationsDiff
+	counters.IndentationsDiffNormalized -= other.IndentationsDiffNormalized
+	counters.KeywordsComplexity -= other.KeywordsComplexity
+	counters.OperatorsComplexity -= other.OperatorsComplexity
+	counters.IndentationsComplexity -= other.IndentationsComplexity
+	counters.IndentationsDiffComplexity -= other.IndentationsDiffComplexity
+	counters.DeepLines -= other.DeepLines
+	counters.MixedIndentation -= other.MixedIndentation
+	counters.MixedIndentationLines -= other.MixedIndentationLines
+	counters.ContinuationLines -= other.ContinuationLines
+	for depth, lines := range other.NestingHistogram {
+		counters.NestingHistogram[depth] -= lines
+	}
+	// the deepest nesting left is the deepest depth of the histogram that still has lines
+	counters.MaxNesting = 0
+	for depth := len(counters.NestingHistogram) - 1; depth > 0; depth-- {
+		if counters.NestingHistogram[depth] > 0 {
+			counters.MaxNesting = float64(depth)
+			break
+		}
+	}
 }
 
 func (counters *CodeCounters) average(by float64) *CodeCounters {
@@ -46,16 +152,42 @@ func (counters *CodeCounters) average(by float64) *CodeCounters {
 	averaged.Lines = counters.Lines / by
 	averaged.LinesOfCode = counters.LinesOfCode / by
 	averaged.Keywords = counters.Keywords / by
+	averaged.Operators = counters.Operators / by
 	averaged.Indentations = counters.Indentations / by
 	averaged.IndentationsNormalized = counters.IndentationsNormalized / by
 	averaged.IndentationsDiff = counters.IndentationsDiff / by
 	averaged.IndentationsDiffNormalized = counters.IndentationsDiffNormalized / by
 	averaged.KeywordsComplexity = counters.KeywordsComplexity / by
+	averaged.OperatorsComplexity = counters.OperatorsComplexity / by
 	averaged.IndentationsComplexity = counters.IndentationsComplexity / by
 	averaged.IndentationsDiffComplexity = counters.IndentationsDiffComplexity / by
+	averaged.MaxNesting = counters.MaxNesting
+	averaged.DeepLines = counters.DeepLines / by
+	averaged.MixedIndentation = counters.MixedIndentation / by
+	averaged.MixedIndentationLines = counters.MixedIndentationLines / by
+	averaged.ContinuationLines = counters.ContinuationLines / by
+	for _, lines := range counters.NestingHistogram {
+		averaged.NestingHistogram = append(averaged.NestingHistogram, lines/by)
+	}
 	return averaged
 }
 
+func (summary *CodeSummary) clone() *CodeSummary {
+	cloned := &CodeSummary{CountersByLanguage: make(map[Language]*SummaryCounters, len(summary.CountersByLanguage))}
+	for language, counters := range summary.CountersByLanguage {
+		total := *counters.Total
+		total.NestingHistogram = append([]float64(nil), total.NestingHistogram...)
+		average := *counters.Average
+		average.NestingHistogram = append([]float64(nil), average.NestingHistogram...)
+		cloned.CountersByLanguage[language] = &SummaryCounters{
+			NumberOfFiles: counters.NumberOfFiles,
+			Total:         &total,
+			Average:       &average,
+		}
+	}
+	return cloned
+}
+
 func (counters *CodeCounters) String() string {
 	return fmt.Sprintf("loc=%v,Keywords=%v,indent=%v", counters.LinesOfCode, counters.Keywords, counters.IndentationsNormalized)
 }
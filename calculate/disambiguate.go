@@ -0,0 +1,151 @@
+package calculate
+
+import (
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// disambiguation tells apart the languages sharing an extension, by the content of the file, then by the files next to
+// it, in the spirit of github linguist
+type disambiguation struct {
+	// rules are tried in order, the first matching one decides
+	rules []disambiguationRule
+	// neighbours are extensions of files in the same dir that suggest a language
+	neighbours map[string]Language
+	// dialects are only told apart with the sql-dialects flag, otherwise the detected language is kept
+	dialects bool
+}
+
+type disambiguationRule struct {
+	language Language
+	pattern  *regexp.Regexp
+}
+
+var (
+	objectiveCPattern = regexp.MustCompile(
+		`(?m)^\s*(#import\s|@(interface|implementation|protocol|property|synthesize|end|class)\b)`,
+	)
+	cppPattern = regexp.MustCompile(
+		`(?m)^\s*(template\s*<|(class|namespace)\s+\w+|(public|private|protected)\s*:\s*$|` +
+			`#include\s*<(iostream|string|vector|map|set|memory|algorithm|functional|utility|cstdint|cstdlib|cstdio)>)|` +
+			`\bstd::\w+`,
+	)
+	plpgsqlPattern = regexp.MustCompile(
+		`(?im)\blanguage\s+'?plpgsql\b|\$\$|\braise\s+(notice|warning|info)\b|\breturns\s+(trigger|setof)\b|^\s*perform\s+\w+`,
+	)
+	tsqlPattern = regexp.MustCompile(
+		`(?im)^\s*go\s*$|@@\w+|\bdeclare\s+@|\bbegin\s+(try|tran|transaction)\b|\bset\s+nocount\b|\bexec(ute)?\s+sp_\w+|\[dbo\]`,
+	)
+	plsqlPattern = regexp.MustCompile(
+		`(?im)^\s*create\s+(or\s+replace\s+)?(package|procedure|function|trigger|type)\b.*\b(is|as)\s*$|` +
+			`\bdbms_\w+\.|%(row)?type\b|\belsif\b|\bpragma\s+\w+|^\s*/\s*$`,
+	)
+	matlabPattern = regexp.MustCompile(`(?m)^\s*(%[{}]?(\s|$)|function\s+(\[[^\]]*\]\s*=\s*|\w+\s*=\s*)?\w+|end\s*;?\s*$)`)
+)
+
+var sqlDialects = &disambiguation{
+	rules: []disambiguationRule{
+		{language: "plpgsql", pattern: plpgsqlPattern},
+		{language: "tsql", pattern: tsqlPattern},
+		{language: "plsql", pattern: plsqlPattern},
+	},
+	dialects: true,
+}
+
+var extensionToDisambiguation = map[string]*disambiguation{
+	"sql":   sqlDialects,
+	"pls":   sqlDialects,
+	"plsql": sqlDialects,
+	"tsql":  sqlDialects,
+	"pgsql": sqlDialects,
+	"h": {
+		rules: []disambiguationRule{
+			{language: "objectivec", pattern: objectiveCPattern},
+			{language: "cpp", pattern: cppPattern},
+		},
+		neighbours: map[string]Language{
+			"c":   "c",
+			"cpp": "cpp", "cxx": "cpp", "cc": "cpp", "hpp": "cpp", "hh": "cpp",
+			"m": "objectivec", "mm": "objectivec",
+		},
+	},
+	"m": {
+		rules: []disambiguationRule{
+			{language: "objectivec", pattern: objectiveCPattern},
+			{language: "matlab", pattern: matlabPattern},
+		},
+		neighbours: map[string]Language{
+			"h": "objectivec", "mm": "objectivec",
+			"mat": "matlab", "mlx": "matlab", "fig": "matlab", "slx": "matlab",
+		},
+	},
+}
+
+// disambiguate returns the language of a file detected as the given built-in language by an ambiguous extension,
+// along with the reason for the decision, or the detected language with no reason
+func (a *analyzer) disambiguate(filePath string, content []byte, definition *LanguageDefinition) (Language, string) {
+	ext := strings.TrimPrefix(path.Ext(filePath), ".")
+	d, found := extensionToDisambiguation[ext]
+	if !found || builtins.byName[definition.Name] != definition {
+		// custom definitions of the extension are taken as is
+		return definition.Name, ""
+	}
+	if d.dialects && !a.detectSqlDialects {
+		return definition.Name, ""
+	}
+	for _, rule := range d.rules {
+		if _, supported := a.languages.byName[rule.language]; supported && rule.pattern.Match(content) {
+			return rule.language, "content"
+		}
+	}
+
+	votes := make(map[Language]int)
+	for _, neighbour := range a.dirFileNames(path.Dir(filePath)) {
+		if neighbour == path.Base(filePath) {
+			continue
+		}
+		if language, found := d.neighbours[strings.TrimPrefix(path.Ext(neighbour), ".")]; found {
+			votes[language]++
+		}
+	}
+	language, maxVotes, tie := definition.Name, 0, false
+	for candidate, count := range votes {
+		if count > maxVotes {
+			language, maxVotes, tie = candidate, count, false
+		} else if count == maxVotes {
+			tie = true
+		}
+	}
+	if maxVotes > 0 && !tie {
+		if _, supported := a.languages.byName[language]; supported {
+			return language, "neighbouring files"
+		}
+	}
+	return definition.Name, "default"
+}
+
+// dirFileNames are the names of the files in dir, none when it is not in fsys, e.g. in an archive
+func (a *analyzer) dirFileNames(dir string) []string {
+	if a.fsys == nil {
+		return nil
+	}
+	if names, found := a.dirFiles[dir]; found {
+		return names
+	}
+	var names []string
+	entries, err := fs.ReadDir(a.fsys, dir)
+	if err == nil {
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				names = append(names, entry.Name())
+			}
+		}
+	}
+	if a.dirFiles == nil {
+		a.dirFiles = make(map[string][]string)
+	}
+	a.dirFiles[dir] = names
+	return names
+}
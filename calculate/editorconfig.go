@@ -0,0 +1,142 @@
+package calculate
+
+import (
+	"bufio"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+// editorconfig is the part of an .editorconfig file that is counted by, see https://editorconfig.org
+type editorconfig struct {
+	root     bool
+	sections []editorconfigSection
+}
+
+type editorconfigSection struct {
+	// patterns match the paths of the files of the section, any of them
+	patterns []glob.Glob
+	// properties are by their lower case names, e.g. tab_width
+	properties map[string]string
+}
+
+// parseEditorconfig reads the sections of an .editorconfig file in dir, leaving out those with invalid patterns
+func parseEditorconfig(dir string, content string) *editorconfig {
+	config := &editorconfig{}
+	var section *editorconfigSection
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = nil
+			var patterns []glob.Glob
+			for _, pattern := range editorconfigPatterns(dir, line[1:len(line)-1]) {
+				compiled, err := glob.Compile(pattern, '/')
+				if err != nil {
+					patterns = nil
+					break
+				}
+				patterns = append(patterns, compiled)
+			}
+			if len(patterns) > 0 {
+				config.sections = append(config.sections, editorconfigSection{patterns: patterns, properties: make(map[string]string)})
+				section = &config.sections[len(config.sections)-1]
+			}
+			continue
+		}
+		name, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.ToLower(strings.TrimSpace(value))
+		if section != nil {
+			section.properties[name] = value
+		} else if len(config.sections) == 0 && name == "root" {
+			config.root = value == "true"
+		}
+	}
+	return config
+}
+
+// editorconfigPatterns are the globs of a section matching paths from the root of fsys, each starting with /. A pattern
+// without / matches files by name in the dir of the .editorconfig, or in any dir under it
+func editorconfigPatterns(dir string, pattern string) []string {
+	prefix := "/"
+	if dir != "." {
+		prefix = "/" + dir + "/"
+	}
+	if !strings.Contains(pattern, "/") {
+		return []string{prefix + pattern, prefix + "**/" + pattern}
+	}
+	return []string{prefix + strings.TrimPrefix(pattern, "/")}
+}
+
+// editorconfigTabWidth is the tab_width of a file by the .editorconfig files of its dir and of every dir above it, or
+// its indent_size if the tab width is not set, or 0 if none is set
+func (a *analyzer) editorconfigTabWidth(filePath string) int {
+	if a.fsys == nil {
+		return 0
+	}
+	var configs []*editorconfig
+	for dir := path.Dir(filePath); ; dir = path.Dir(dir) {
+		if config := a.editorconfig(dir); config != nil {
+			configs = append(configs, config)
+			if config.root {
+				break
+			}
+		}
+		if dir == "." || dir == "/" {
+			break
+		}
+	}
+
+	properties := make(map[string]string)
+	for i := len(configs) - 1; i >= 0; i-- {
+		for _, section := range configs[i].sections {
+			if section.matches("/" + filePath) {
+				for name, value := range section.properties {
+					properties[name] = value
+				}
+			}
+		}
+	}
+	for _, name := range []string{"tab_width", "indent_size"} {
+		if width, err := strconv.Atoi(properties[name]); err == nil && width > 0 {
+			return width
+		}
+	}
+	return 0
+}
+
+// editorconfig is the .editorconfig file in dir, or nil if there is none
+func (a *analyzer) editorconfig(dir string) *editorconfig {
+	if config, found := a.editorconfigs[dir]; found {
+		return config
+	}
+	var config *editorconfig
+	content, err := fs.ReadFile(a.fsys, path.Join(dir, ".editorconfig"))
+	if err == nil {
+		config = parseEditorconfig(dir, string(content))
+	}
+	if a.editorconfigs == nil {
+		a.editorconfigs = make(map[string]*editorconfig)
+	}
+	a.editorconfigs[dir] = config
+	return config
+}
+
+func (section *editorconfigSection) matches(path string) bool {
+	for _, pattern := range section.patterns {
+		if pattern.Match(path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,288 @@
+package calculate
+
+import (
+	"regexp"
+	"strings"
+)
+
+type blockStyle int
+
+const (
+	braceBlocks blockStyle = iota
+	indentationBlocks
+	endKeywordBlocks
+)
+
+// function is a heuristically detected function, by 0-based line indexes
+type function struct {
+	name      string
+	startLine int
+	endLine   int
+}
+
+var cLikeFunctionPattern = regexp.MustCompile(`^\s*([\w$@][\w$<>\[\],.?*&:~@]*\s+(?:[\w$<>\[\],.?*&:~@]+\s+)*)[*&]*(~?[\w$:]+)\s*\(`)
+
+var nodeFunctionPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^\s*(?:export\s+)?(?:default\s+)?(?:async\s+)?function\s*\*?\s*(\w+)`),
+	regexp.MustCompile(`^\s*(?:export\s+)?(?:const|let|var)\s+(\w+)\s*=\s*(?:async\s+)?(?:function\b|\([^)]*\)\s*(?::\s*[^=]+)?=>|\w+\s*=>)`),
+	regexp.MustCompile(`^\s*(?:(?:async|static|get|set|public|private|protected|readonly|override)\s+)*(\w+)\s*\([^)]*\)\s*(?::\s*[^{]+)?\{\s*$`),
+}
+
+var fortranFunctionPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)^\s*(?:(?:pure|elemental|recursive|impure|module|integer|real|logical|complex|character|double\s+precision|type\([^)]*\))\s+)*(?:function|subroutine)\s+(\w+)`),
+}
+
+var languageToFunctionPatterns = map[Language][]*regexp.Regexp{
+	"go":            {regexp.MustCompile(`^\s*func\s+(?:\([^)]*\)\s*)?(\w+)`)},
+	"python":        {regexp.MustCompile(`^\s*(?:async\s+)?def\s+(\w+)`)},
+	"starlark":      {regexp.MustCompile(`^\s*def\s+(\w+)`)},
+	"ruby":          {regexp.MustCompile(`^\s*def\s+(?:self\.)?([\w?!=\[\]+\-*/<>]+)`)},
+	"node":          nodeFunctionPatterns,
+	"javascript":    nodeFunctionPatterns,
+	"typescript":    nodeFunctionPatterns,
+	"kotlin":        {regexp.MustCompile(`^\s*(?:[\w@]+\s+)*fun\s+(?:<[^>]*>\s*)?(?:[\w.]+\.)?(\w+)\s*\(`)},
+	"scala":         {regexp.MustCompile(`^\s*(?:[\w@]+\s+)*def\s+(\w+)`)},
+	"swift":         {regexp.MustCompile(`^\s*(?:[\w@]+\s+)*(?:func\s+(\w+)|(init)\s*[(<?])`)},
+	"rust":          {regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?(?:(?:async|const|unsafe|extern\s+"\w+")\s+)*fn\s+(\w+)`)},
+	"shell":         {regexp.MustCompile(`^\s*(?:function\s+([\w.:-]+)|([\w.:-]+)\s*\(\s*\))`)},
+	"powershell":    {regexp.MustCompile(`(?i)^\s*(?:function|filter)\s+([\w-]+)`)},
+	"php":           {regexp.MustCompile(`^\s*(?:(?:abstract|final|public|private|protected|static)\s+)*function\s+&?(\w+)`)},
+	"fortran":       fortranFunctionPatterns,
+	"fortran-fixed": fortranFunctionPatterns,
+	"objectivec":    {regexp.MustCompile(`^\s*[-+]\s*\([^)]*\)\s*(\w+)`), cLikeFunctionPattern},
+	"java":          {cLikeFunctionPattern},
+	"csharp":        {cLikeFunctionPattern},
+	"c":             {cLikeFunctionPattern},
+	"cpp":           {cLikeFunctionPattern},
+}
+
+var languageToBlockStyle = map[Language]blockStyle{
+	"python":        indentationBlocks,
+	"starlark":      indentationBlocks,
+	"ruby":          endKeywordBlocks,
+	"fortran":       endKeywordBlocks,
+	"fortran-fixed": endKeywordBlocks,
+}
+
+// notFunctionNames are control statements and expressions that look like a function declaration to the patterns
+var notFunctionNames = map[string]bool{
+	"if": true, "for": true, "foreach": true, "while": true, "switch": true, "catch": true, "return": true,
+	"sizeof": true, "else": true, "new": true, "throw": true, "using": true, "lock": true, "synchronized": true,
+	"function": true, "when": true, "case": true, "do": true, "await": true, "delete": true, "typeof": true,
+}
+
+var fortranEndPattern = regexp.MustCompile(`(?i)^\s*end(\s+(function|subroutine)(\s+\w+)?)?\s*$`)
+
+// languageToEndPatterns match the lines ending functions of end keyword blocks at any indentation, e.g. in fortran
+var languageToEndPatterns = map[Language]*regexp.Regexp{
+	"fortran":       fortranEndPattern,
+	"fortran-fixed": fortranEndPattern,
+}
+
+func findFunctions(lines []string, definition *LanguageDefinition) []*function {
+	patterns, found := languageToFunctionPatterns[definition.Name]
+	if !found {
+		return nil
+	}
+	var functions []*function
+	for i, line := range lines {
+		name := matchFunctionName(line, patterns)
+		if len(name) == 0 {
+			continue
+		}
+		endLine := findFunctionEnd(lines, i, definition)
+		if endLine == -1 {
+			// declaration only
+			continue
+		}
+		functions = append(functions, &function{name: name, startLine: i, endLine: endLine})
+	}
+	return functions
+}
+
+func matchFunctionName(line string, patterns []*regexp.Regexp) string {
+	for _, pattern := range patterns {
+		match := pattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		name := ""
+		for _, group := range match[1:] {
+			if len(group) > 0 {
+				name = group
+			}
+		}
+		if pattern == cLikeFunctionPattern {
+			if strings.HasSuffix(strings.TrimSpace(line), ";") || notFunctionNames[strings.Fields(match[1])[0]] {
+				continue
+			}
+		}
+		if notFunctionNames[name] {
+			continue
+		}
+		return name
+	}
+	return ""
+}
+
+func findFunctionEnd(lines []string, startLine int, definition *LanguageDefinition) int {
+	switch languageToBlockStyle[definition.Name] {
+	case indentationBlocks:
+		return findIndentationBlockEnd(lines, startLine)
+	case endKeywordBlocks:
+		return findEndKeywordBlockEnd(lines, startLine, definition)
+	default:
+		return findBraceBlockEnd(lines, startLine, definition)
+	}
+}
+
+// maxSignatureLines is how far the opening brace may be from the function name
+const maxSignatureLines = 10
+
+func findBraceBlockEnd(lines []string, startLine int, definition *LanguageDefinition) int {
+	depth := 0
+	parentheses := 0
+	opened := false
+	for i := startLine; i < len(lines) && (opened || i-startLine < maxSignatureLines); i++ {
+		code := stripStringsAndComments(lines[i], definition)
+		for j, c := range code {
+			switch c {
+			case '{':
+				depth++
+				opened = true
+			case '}':
+				depth--
+				// braces closed before the body opens are types in the signature, e.g. interface{}
+				if opened && depth <= 0 && !strings.Contains(code[j+1:], "{") {
+					return i
+				}
+			case '(':
+				parentheses++
+			case ')':
+				parentheses--
+			}
+		}
+		if opened {
+			continue
+		}
+		trimmed := strings.TrimSpace(code)
+		if strings.HasSuffix(trimmed, ";") {
+			// prototype or abstract declaration
+			return -1
+		}
+		if i == startLine && (strings.Contains(trimmed, "=>") || strings.Contains(trimmed, " = ")) && !strings.HasSuffix(trimmed, "=") {
+			// single expression body
+			return i
+		}
+		if parentheses <= 0 && !continuesSignature(trimmed, lines, i+1) {
+			// declaration without a body
+			return -1
+		}
+	}
+	return -1
+}
+
+var signatureContinuationPrefixes = []string{"{", "throws", "where", ":", "->", "=>", ",", "const", "override", "noexcept", "+", "-", "."}
+var signatureContinuationSuffixes = []string{",", "(", "->", ":", "=", "throws"}
+
+func continuesSignature(code string, lines []string, nextLine int) bool {
+	for _, suffix := range signatureContinuationSuffixes {
+		if strings.HasSuffix(code, suffix) {
+			return true
+		}
+	}
+	if nextLine >= len(lines) {
+		return false
+	}
+	next := strings.TrimSpace(lines[nextLine])
+	for _, prefix := range signatureContinuationPrefixes {
+		if strings.HasPrefix(next, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func findIndentationBlockEnd(lines []string, startLine int) int {
+	indentation := len(lines[startLine]) - len(trimSpaceLeft(lines[startLine]))
+	endLine := startLine
+	for i := startLine + 1; i < len(lines); i++ {
+		cleanLine := strings.TrimSpace(lines[i])
+		if len(cleanLine) == 0 {
+			continue
+		}
+		if len(lines[i])-len(trimSpaceLeft(lines[i])) <= indentation {
+			break
+		}
+		endLine = i
+	}
+	return endLine
+}
+
+func findEndKeywordBlockEnd(lines []string, startLine int, definition *LanguageDefinition) int {
+	startCode := strings.TrimSpace(stripStringsAndComments(lines[startLine], definition))
+	signatureEnd := strings.LastIndex(startCode, ")")
+	if signatureEnd == -1 {
+		signatureEnd = 0
+	}
+	if strings.HasSuffix(startCode, "end") || strings.Contains(startCode[signatureEnd:], " = ") {
+		// one liner
+		return startLine
+	}
+	indentation := len(lines[startLine]) - len(trimSpaceLeft(lines[startLine]))
+	for i := startLine + 1; i < len(lines); i++ {
+		if endPattern, found := languageToEndPatterns[definition.Name]; found {
+			if endPattern.MatchString(lines[i]) {
+				return i
+			}
+			continue
+		}
+		cleanLine := strings.TrimSpace(lines[i])
+		if (cleanLine == "end" || strings.HasPrefix(cleanLine, "end ")) && len(lines[i])-len(trimSpaceLeft(lines[i])) == indentation {
+			return i
+		}
+	}
+	return len(lines) - 1
+}
+
+// stripStringsAndComments roughly blanks out string literals and drops a trailing line comment
+func stripStringsAndComments(line string, definition *LanguageDefinition) string {
+	stripped := make([]byte, 0, len(line))
+	for i := 0; i < len(line); i++ {
+		if delimiter := stringDelimiterAt(line, i, definition.StringDelimiters, definition.CharLiterals); len(delimiter) > 0 {
+			stripped = append(stripped, delimiter...)
+			i = skipString(line, i, delimiter)
+			if i < len(line) {
+				stripped = append(stripped, delimiter...)
+			}
+			continue
+		}
+		if isLineCommentAt(line, i, definition.LineComments) {
+			break
+		}
+		stripped = append(stripped, line[i])
+	}
+	return string(stripped)
+}
+
+// isLineCommentAt is whether a line comment starts at i. A marker of one character starts a comment only as a token of
+// its own, e.g. not # of $# in shell or of #available in swift
+func isLineCommentAt(line string, i int, lineComments []string) bool {
+	for _, marker := range lineComments {
+		if len(marker) == 0 || !strings.HasPrefix(line[i:], marker) {
+			continue
+		}
+		if len(marker) > 1 && !isWordByte(marker[0]) {
+			return true
+		}
+		next := i + len(marker)
+		if (i == 0 || line[i-1] == ' ' || line[i-1] == '\t') && (next == len(line) || !isWordByte(line[next])) {
+			return true
+		}
+	}
+	return false
+}
+
+func isCharLiteral(s string) bool {
+	return (len(s) > 2 && s[2] == '\'') || (len(s) > 3 && s[1] == '\\' && s[3] == '\'')
+}
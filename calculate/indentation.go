@@ -0,0 +1,43 @@
+package calculate
+
+// defaultTabWidth is the columns of a tab, see the tab-width flag
+const defaultTabWidth = 4
+
+// indentationWidth is the columns of the indentation of the line, a tab advances to the next multiple of tabWidth
+func indentationWidth(indentation string, tabWidth int) int {
+	width := 0
+	for _, c := range indentation {
+		if c == '\t' && tabWidth > 0 {
+			width += tabWidth - width%tabWidth
+		} else {
+			width++
+		}
+	}
+	return width
+}
+
+// indentationStyle tells the lines of a file indented unlike its first indented line, or by spaces before a tab
+type indentationStyle struct {
+	// first is the first character of the first indentation, a space or a tab
+	first byte
+}
+
+// isMixed is whether the indentation mixes tabs and spaces, in itself or with the lines before it. Spaces after tabs
+// align rather than indent, e.g. the arguments of a call wrapped under its first one
+func (style *indentationStyle) isMixed(indentation string) bool {
+	if len(indentation) == 0 {
+		return false
+	}
+	if style.first == 0 {
+		style.first = indentation[0]
+	}
+	if indentation[0] != style.first {
+		return true
+	}
+	for i := 1; i < len(indentation); i++ {
+		if indentation[i] == '\t' && indentation[i-1] == ' ' {
+			return true
+		}
+	}
+	return false
+}
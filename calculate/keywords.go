@@ -1,525 +1,1226 @@
 package calculate
 
-import "strings"
+import (
+	"sort"
+	"strings"
+)
 
-func countKeywords(line string, language Language) float64 {
-	keywords, found := languageToKeywords[language]
-	if !found {
+// keywordMatcher counts the keywords of a language in lines out of strings, on token boundaries whatever the
+// formatting, e.g. if in }else if(x){, and keywords of several words, e.g. else if, whatever the space between them
+type keywordMatcher struct {
+	// phrases are the words of every keyword by its first byte, longest first
+	phrases          map[byte][]keywordPhrase
+	endKeywords      map[string]bool
+	stringDelimiters []string
+	charLiterals     bool
+	caseInsensitive  bool
+	atSignKeywords   bool
+}
+
+type keywordPhrase struct {
+	keyword string
+	words   []string
+}
+
+func newKeywordMatcher(definition *LanguageDefinition) *keywordMatcher {
+	m := &keywordMatcher{
+		phrases:          make(map[byte][]keywordPhrase),
+		endKeywords:      make(map[string]bool),
+		stringDelimiters: definition.StringDelimiters,
+		charLiterals:     definition.CharLiterals,
+		caseInsensitive:  definition.CaseInsensitiveKeywords,
+		atSignKeywords:   definition.AtSignKeywords,
+	}
+	for _, keyword := range definition.Keywords {
+		if m.caseInsensitive {
+			keyword = strings.ToLower(keyword)
+		}
+		words := strings.Fields(keyword)
+		if len(words) == 0 {
+			continue
+		}
+		m.phrases[keyword[0]] = append(m.phrases[keyword[0]], keywordPhrase{keyword: keyword, words: words})
+	}
+	for _, phrases := range m.phrases {
+		sort.SliceStable(phrases, func(i, j int) bool {
+			return len(phrases[i].keyword) > len(phrases[j].keyword)
+		})
+	}
+	for _, endKeyword := range definition.EndKeywords {
+		if m.caseInsensitive {
+			endKeyword = strings.ToLower(endKeyword)
+		}
+		m.endKeywords[endKeyword] = true
+	}
+	return m
+}
+
+// count is the number of distinct keywords in the line, and of its tokens starting with @ if they are keywords
+func (m *keywordMatcher) count(line string) float64 {
+	if len(m.phrases) == 0 && !m.atSignKeywords {
 		return 0
 	}
+	if m.caseInsensitive {
+		line = strings.ToLower(line)
+	}
 	keywordsCount := float64(0)
-	tokens := strings.Fields(line)
-	tokensSet := make(map[string]bool, len(tokens))
-	for _, token := range strings.Fields(line) {
-		if strings.HasPrefix(token, "@") && !strings.HasPrefix(token, "@\"") {
-			if _, found := languagesWithAtSignPrefix[language]; found {
+	found := make(map[string]bool)
+	for i := 0; i < len(line); {
+		if delimiter := stringDelimiterAt(line, i, m.stringDelimiters, m.charLiterals); len(delimiter) > 0 {
+			i = skipString(line, i, delimiter) + 1
+			continue
+		}
+		if !isWordByte(line[i]) {
+			if line[i] == '@' && m.atSignKeywords && i+1 < len(line) && isWordByte(line[i+1]) && !hasWordBefore(line, i) {
 				keywordsCount++
 			}
+			// e.g. #define or (if
+			if end := m.matchAt(line, i, found); end != -1 {
+				i = end
+			} else {
+				i++
+			}
+			continue
+		}
+		if hasWordBefore(line, i) {
+			i++
+			continue
+		}
+		wordEnd := endOfWord(line, i)
+		if i > 0 && (line[i-1] == '.' || line[i-1] == '@') {
+			// a member, e.g. .class or .catch(, or an annotation
+			i = wordEnd
+			continue
+		}
+		end := m.matchAt(line, i, found)
+		if end == -1 {
+			end = wordEnd
+		}
+		if m.endKeywords[line[i:wordEnd]] {
+			// the end of a block, e.g. If of End If
+			next := end
+			for next < len(line) && (line[next] == ' ' || line[next] == '\t') {
+				next++
+			}
+			if next < len(line) && isWordByte(line[next]) {
+				end = endOfWord(line, next)
+			}
 		}
-		token = strings.TrimRight(strings.TrimRight(token, ";"), "{")
-		tokensSet[token] = true
+		i = end
 	}
-	for _, keyword := range keywords {
-		if _, found := tokensSet[keyword]; found {
-			keywordsCount++
+	return keywordsCount + float64(len(found))
+}
+
+// matchAt is the end of the longest keyword at i, or -1 if none
+func (m *keywordMatcher) matchAt(line string, i int, found map[string]bool) int {
+	for _, phrase := range m.phrases[line[i]] {
+		if end := phrase.matchAt(line, i); end != -1 {
+			found[phrase.keyword] = true
+			return end
 		}
 	}
-	return keywordsCount
-}
-
-var languageToKeywords = map[Language][]string{
-	"java": {
-		"break",
-		"case",
-		"catch",
-		"class",
-		"continue",
-		"do",
-		"else",
-		"enum",
-		"extends",
-		"finally",
-		"for",
-		"goto",
-		"if",
-		"implement",
-		"imports",
-		"interface",
-		"return",
-		"switch",
-		"throw",
-		"try",
-		"while",
-	},
-	"csharp": {
-		"await",
-		"break",
-		"case",
-		"catch",
-		"class",
-		"continue",
-		"delegate",
-		"do",
-		"else",
-		"enum",
-		"event",
-		"extern",
-		"finally",
-		"for",
-		"foreach",
-		"goto",
-		"if",
-		"init",
-		"interface",
-		"return",
-		"struct",
-		"switch",
-		"throw",
-		"try",
-		"while",
-		"from",
-		"get",
-		"set",
-		"join",
-		"let",
-		"using",
-		"yield",
-	},
-	"node": {
-		"await",
-		"break",
-		"case",
-		"catch",
-		"class",
-		"continue",
-		"do",
-		"else",
-		"enum",
-		"eval",
-		"extends",
-		"finally",
-		"for",
-		"function",
-		"goto",
-		"if",
-		"implements",
-		"import",
-		"in",
-		"interface",
-		"package",
-		"return",
-		"switch",
-		"try",
-		"while",
-		"with",
-		"yield",
-	},
-	"python": {
-		"break",
-		"class",
-		"continue",
-		"def",
-		"elif",
-		"else",
-		"except",
-		"finally",
-		"for",
-		"from",
-		"if",
-		"import",
-		"in",
-		"lambda",
-		"pass",
-		"raise",
-		"return",
-		"try",
-		"yield",
-		"with",
-		"while",
-	},
-	"kotlin": {
-		"break",
-		"class",
-		"continue",
-		"do",
-		"else",
-		"for",
-		"fun",
-		"if",
-		"interface",
-		"return",
-		"throw",
-		"try",
-		"typealias",
-		"when",
-		"while",
-		"catch",
-		"constructor",
-		"delegate",
-		"field",
-		"finally",
-		"get",
-		"import",
-		"init",
-		"property",
-		"receiver",
-		"set",
-		"setparam",
-		"where",
-		"enum",
-	},
-	"c": {
-		"break",
-		"case",
-		"continue",
-		"do",
-		"else",
-		"for",
-		"goto",
-		"if",
-		"return",
-		"struct",
-		"switch",
-		"typedef",
-		"union",
-		"while",
-		"enum",
-		"#define",
-		"#ifdef",
-		"#ifndef",
-		"#include",
-	},
-	"cpp": {
-		"break",
-		"case",
-		"catch",
-		"class",
-		"continue",
-		"do",
-		"else",
-		"for",
-		"goto",
-		"if",
-		"namespace",
-		"return",
-		"struct",
-		"switch",
-		"template",
-		"throw",
-		"try",
-		"typename",
-		"typedef",
-		"union",
-		"using",
-		"while",
-		"#define",
-		"#ifdef",
-		"#ifndef",
-		"#include",
-	},
-	"objectivec": {
-		"break",
-		"case",
-		"continue",
-		"do",
-		"else",
-		"enum",
-		"for",
-		"goto",
-		"if",
-		"return",
-		"struct",
-		"switch",
-		"typedef",
-		"union",
-		"while",
-		"#import",
-	},
-	"swift": {
-		"class",
-		"deinit",
-		"enum",
-		"extension",
-		"func",
-		"import",
-		"init",
-		"protocol",
-		"struct",
-		"subscript",
-		"typealias",
-		"break",
-		"case",
-		"continue",
-		"do",
-		"else",
-		"fallthrough",
-		"for",
-		"if",
-		"in",
-		"return",
-		"switch",
-		"where",
-		"while",
-		"didSet",
-		"get",
-		"set",
-		"willSet",
-	},
-	"ruby": {
-		"begin",
-		"break",
-		"case",
-		"class",
-		"def",
-		"do",
-		"else",
-		"elsif",
-		"end",
-		"ensure",
-		"for",
-		"if",
-		"in",
-		"include",
-		"load",
-		"module",
-		"next",
-		"redo",
-		"rescue",
-		"retry",
-		"return",
-		"require",
-		"require_relative",
-		"then",
-		"unless",
-		"until",
-		"when",
-		"while",
-		"yield",
-	},
-	"go": {
-		"break",
-		"case",
-		"continue",
-		"defer",
-		"else",
-		"fallthrough",
-		"for",
-		"func",
-		"go",
-		"goto",
-		"if",
-		"import",
-		"interface",
-		"range",
-		"return",
-		"select",
-		"struct",
-		"switch",
-	},
-	"rust": {
-		"break",
-		"continue",
-		"else",
-		"enum",
-		"extern",
-		"fn",
-		"for",
-		"if",
-		"impl",
-		"loop",
-		"match",
-		"return",
-		"struct",
-		"trait",
-		"use",
-		"where",
-		"while",
-		"async",
-		"await",
-		"do",
-		"macro",
-		"yield",
-		"try",
-		"union",
-		"macro_rules",
-	},
-	"scala": {
-		"case",
-		"catch",
-		"class",
-		"def",
-		"do",
-		"else",
-		"extends",
-		"finally",
-		"for",
-		"forSome",
-		"if",
-		"import",
-		"match",
-		"return",
-		"throw",
-		"trait",
-		"try",
-		"type",
-		"while",
-		"with",
-		"yield",
-	},
-	"php": {
-		"abstract",
-		"and",
-		"as",
-		"break",
-		"callable",
-		"case",
-		"catch",
-		"class",
-		"clone",
-		"const",
-		"continue",
-		"declare",
-		"default",
-		"do",
-		"echo",
-		"else",
-		"elseif",
-		"enddeclare",
-		"endfor",
-		"endforeach",
-		"endif",
-		"endswitch",
-		"endwhile",
-		"extends",
-		"final",
-		"finally",
-		"for",
-		"foreach",
-		"function",
-		"global",
-		"goto",
-		"if",
-		"implements",
-		"include",
-		"include_once",
-		"instanceof",
-		"insteadof",
-		"interface",
-		"match",
-		"namespace",
-		"new",
-		"or",
-		"print",
-		"private",
-		"protected",
-		"public",
-		"require",
-		"require_once",
-		"return",
-		"static",
-		"switch",
-		"throw",
-		"trait",
-		"try",
-		"use",
-		"var",
-		"while",
-		"xor",
-		"yield",
-	},
-	"fortran": {
-		"abstract",
-		"allocatable",
-		"allocate",
-		"assign",
-		"associate",
-		"asynchronous",
-		"backspace",
-		"block",
-		"block data",
-		"case",
-		"codimension",
-		"common",
-		"contains",
-		"contiguous",
-		"critical",
-		"cycle",
-		"data",
-		"deallocate",
-		"deferred",
-		"do",
-		"do concurrent",
-		"else",
-		"else if",
-		"end",
-		"endfile",
-		"endif",
-		"entry",
-		"equivalence",
-		"external",
-		"final",
-		"flush",
-		"format",
-		"forall",
-		"function",
-		"generic",
-		"goto",
-		"if",
-		"implicit",
-		"include",
-		"inquire",
-		"intrinsic",
-		"lock",
-		"module",
-		"namelist",
-		"nullify",
-		"only",
-		"operator",
-		"optional",
-		"pause",
-		"pass",
-		"pointer",
-		"procedure",
-		"program",
-		"private",
-		"public",
-		"recursive",
-		"result",
-		"rewrite",
-		"save",
-		"select",
-		"select rank",
-		"sequence",
-		"stop",
-		"submodule",
-		"subroutine",
-		"sync all",
-		"sync images",
-		"sync memory",
-		"target",
-		"then",
-		"use",
-		"volatile",
-		"wait",
-		"while",
-		"write",
-		"impure",
-		"error stop",
-		"non_overridable",
-		"non_recursive",
-		"import (in interfaces)",
-		"element",
-		"elemental",
-		"extend",
-		"enumerator",
-	},
-}
-
-var languagesWithAtSignPrefix = map[Language]bool{
-	"java":       true,
-	"objectivec": true,
-	"python":     true,
-	"kotlin":     true,
-	"scala":      true,
-	"node":       true,
+	return -1
+}
+
+func (phrase *keywordPhrase) matchAt(line string, i int) int {
+	if isWordByte(phrase.keyword[0]) && hasWordBefore(line, i) {
+		return -1
+	}
+	j := i
+	for k, word := range phrase.words {
+		if k > 0 {
+			spaceStart := j
+			for j < len(line) && (line[j] == ' ' || line[j] == '\t') {
+				j++
+			}
+			if j == spaceStart {
+				return -1
+			}
+		}
+		if !strings.HasPrefix(line[j:], word) {
+			return -1
+		}
+		j += len(word)
+	}
+	if isWordByte(phrase.keyword[len(phrase.keyword)-1]) && hasWordAfter(line, j) {
+		return -1
+	}
+	return j
+}
+
+// isWordByte is whether b is part of an identifier, any non-ascii byte is
+func isWordByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b == '_' || b >= 0x80
+}
+
+func isLetterByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+// hasWordBefore is whether the word at i continues one before it, also by a hyphen between letters, e.g. END-IF
+func hasWordBefore(line string, i int) bool {
+	return i > 0 && (isWordByte(line[i-1]) || i > 1 && line[i-1] == '-' && isLetterByte(line[i-2]) && isLetterByte(line[i]))
+}
+
+func hasWordAfter(line string, j int) bool {
+	return j < len(line) && (isWordByte(line[j]) ||
+		j+1 < len(line) && line[j] == '-' && isLetterByte(line[j-1]) && isLetterByte(line[j+1]))
+}
+
+func endOfWord(line string, i int) int {
+	j := i + 1
+	for j < len(line) && (isWordByte(line[j]) || hasWordAfter(line, j)) {
+		j++
+	}
+	return j
+}
+
+var javaKeywords = []string{
+	"break",
+	"case",
+	"catch",
+	"class",
+	"continue",
+	"do",
+	"else",
+	"enum",
+	"extends",
+	"finally",
+	"for",
+	"goto",
+	"if",
+	"implement",
+	"imports",
+	"interface",
+	"return",
+	"switch",
+	"throw",
+	"try",
+	"while",
+}
+
+var cSharpKeywords = []string{
+	"await",
+	"break",
+	"case",
+	"catch",
+	"class",
+	"continue",
+	"delegate",
+	"do",
+	"else",
+	"enum",
+	"event",
+	"extern",
+	"finally",
+	"for",
+	"foreach",
+	"goto",
+	"if",
+	"init",
+	"interface",
+	"return",
+	"struct",
+	"switch",
+	"throw",
+	"try",
+	"while",
+	"from",
+	"get",
+	"set",
+	"join",
+	"let",
+	"using",
+	"yield",
+}
+
+var nodeKeywords = []string{
+	"await",
+	"break",
+	"case",
+	"catch",
+	"class",
+	"continue",
+	"do",
+	"else",
+	"enum",
+	"eval",
+	"extends",
+	"finally",
+	"for",
+	"function",
+	"goto",
+	"if",
+	"implements",
+	"import",
+	"in",
+	"interface",
+	"package",
+	"return",
+	"switch",
+	"try",
+	"while",
+	"with",
+	"yield",
+}
+
+var typescriptKeywords = append(
+	append([]string{}, nodeKeywords...),
+	"abstract",
+	"declare",
+	"namespace",
+	"type",
+)
+
+var pythonKeywords = []string{
+	"break",
+	"class",
+	"continue",
+	"def",
+	"elif",
+	"else",
+	"except",
+	"finally",
+	"for",
+	"from",
+	"if",
+	"import",
+	"in",
+	"lambda",
+	"pass",
+	"raise",
+	"return",
+	"try",
+	"yield",
+	"with",
+	"while",
+}
+
+var kotlinKeywords = []string{
+	"break",
+	"class",
+	"continue",
+	"do",
+	"else",
+	"for",
+	"fun",
+	"if",
+	"interface",
+	"return",
+	"throw",
+	"try",
+	"typealias",
+	"when",
+	"while",
+	"catch",
+	"constructor",
+	"delegate",
+	"field",
+	"finally",
+	"get",
+	"import",
+	"init",
+	"property",
+	"receiver",
+	"set",
+	"setparam",
+	"where",
+	"enum",
+}
+
+var cKeywords = []string{
+	"break",
+	"case",
+	"continue",
+	"do",
+	"else",
+	"for",
+	"goto",
+	"if",
+	"return",
+	"struct",
+	"switch",
+	"typedef",
+	"union",
+	"while",
+	"enum",
+	"#define",
+	"#ifdef",
+	"#ifndef",
+	"#include",
+}
+
+var cppKeywords = []string{
+	"break",
+	"case",
+	"catch",
+	"class",
+	"continue",
+	"do",
+	"else",
+	"for",
+	"goto",
+	"if",
+	"namespace",
+	"return",
+	"struct",
+	"switch",
+	"template",
+	"throw",
+	"try",
+	"typename",
+	"typedef",
+	"union",
+	"using",
+	"while",
+	"#define",
+	"#ifdef",
+	"#ifndef",
+	"#include",
+}
+
+var objectiveCKeywords = []string{
+	"break",
+	"case",
+	"continue",
+	"do",
+	"else",
+	"enum",
+	"for",
+	"goto",
+	"if",
+	"return",
+	"struct",
+	"switch",
+	"typedef",
+	"union",
+	"while",
+	"#import",
+}
+
+var swiftKeywords = []string{
+	"class",
+	"deinit",
+	"enum",
+	"extension",
+	"func",
+	"import",
+	"init",
+	"protocol",
+	"struct",
+	"subscript",
+	"typealias",
+	"break",
+	"case",
+	"continue",
+	"do",
+	"else",
+	"fallthrough",
+	"for",
+	"if",
+	"in",
+	"return",
+	"switch",
+	"where",
+	"while",
+	"didSet",
+	"get",
+	"set",
+	"willSet",
+}
+
+var rubyKeywords = []string{
+	"begin",
+	"break",
+	"case",
+	"class",
+	"def",
+	"do",
+	"else",
+	"elsif",
+	"end",
+	"ensure",
+	"for",
+	"if",
+	"in",
+	"include",
+	"load",
+	"module",
+	"next",
+	"redo",
+	"rescue",
+	"retry",
+	"return",
+	"require",
+	"require_relative",
+	"then",
+	"unless",
+	"until",
+	"when",
+	"while",
+	"yield",
+}
+
+var goKeywords = []string{
+	"break",
+	"case",
+	"continue",
+	"defer",
+	"else",
+	"fallthrough",
+	"for",
+	"func",
+	"go",
+	"goto",
+	"if",
+	"import",
+	"interface",
+	"range",
+	"return",
+	"select",
+	"struct",
+	"switch",
+}
+
+var rustKeywords = []string{
+	"break",
+	"continue",
+	"else",
+	"enum",
+	"extern",
+	"fn",
+	"for",
+	"if",
+	"impl",
+	"loop",
+	"match",
+	"return",
+	"struct",
+	"trait",
+	"use",
+	"where",
+	"while",
+	"async",
+	"await",
+	"do",
+	"macro",
+	"yield",
+	"try",
+	"union",
+	"macro_rules",
+}
+
+var scalaKeywords = []string{
+	"case",
+	"catch",
+	"class",
+	"def",
+	"do",
+	"else",
+	"extends",
+	"finally",
+	"for",
+	"forSome",
+	"if",
+	"import",
+	"match",
+	"return",
+	"throw",
+	"trait",
+	"try",
+	"type",
+	"while",
+	"with",
+	"yield",
+}
+
+var phpKeywords = []string{
+	"abstract",
+	"and",
+	"as",
+	"break",
+	"callable",
+	"case",
+	"catch",
+	"class",
+	"clone",
+	"const",
+	"continue",
+	"declare",
+	"default",
+	"do",
+	"echo",
+	"else",
+	"elseif",
+	"enddeclare",
+	"endfor",
+	"endforeach",
+	"endif",
+	"endswitch",
+	"endwhile",
+	"extends",
+	"final",
+	"finally",
+	"for",
+	"foreach",
+	"function",
+	"global",
+	"goto",
+	"if",
+	"implements",
+	"include",
+	"include_once",
+	"instanceof",
+	"insteadof",
+	"interface",
+	"match",
+	"namespace",
+	"new",
+	"or",
+	"print",
+	"private",
+	"protected",
+	"public",
+	"require",
+	"require_once",
+	"return",
+	"static",
+	"switch",
+	"throw",
+	"trait",
+	"try",
+	"use",
+	"var",
+	"while",
+	"xor",
+	"yield",
+}
+
+var groovyKeywords = []string{
+	"assert",
+	"break",
+	"case",
+	"catch",
+	"class",
+	"continue",
+	"def",
+	"default",
+	"do",
+	"else",
+	"enum",
+	"extends",
+	"finally",
+	"for",
+	"if",
+	"implements",
+	"in",
+	"interface",
+	"return",
+	"switch",
+	"throw",
+	"trait",
+	"try",
+	"while",
+}
+
+var shellKeywords = []string{
+	"break",
+	"case",
+	"continue",
+	"elif",
+	"else",
+	"esac",
+	"fi",
+	"for",
+	"function",
+	"if",
+	"return",
+	"select",
+	"then",
+	"trap",
+	"until",
+	"while",
+}
+
+var powershellKeywords = []string{
+	"break",
+	"catch",
+	"continue",
+	"do",
+	"else",
+	"elseif",
+	"filter",
+	"finally",
+	"for",
+	"foreach",
+	"function",
+	"if",
+	"return",
+	"switch",
+	"throw",
+	"trap",
+	"try",
+	"until",
+	"while",
+}
+
+var sqlKeywords = []string{
+	"BEGIN",
+	"CASE",
+	"CATCH",
+	"CONTINUE",
+	"CURSOR",
+	"ELSE",
+	"ELSEIF",
+	"ELSIF",
+	"EXCEPTION",
+	"EXIT",
+	"FOR",
+	"FOREACH",
+	"GOTO",
+	"IF",
+	"LOOP",
+	"RAISE",
+	"RETURN",
+	"THROW",
+	"TRY",
+	"WHEN",
+	"WHILE",
+}
+
+var haskellKeywords = []string{
+	"case",
+	"class",
+	"do",
+	"else",
+	"guard",
+	"if",
+	"instance",
+	"otherwise",
+	"unless",
+	"when",
+	"where",
+}
+
+var elixirKeywords = []string{
+	"case",
+	"catch",
+	"cond",
+	"def",
+	"defp",
+	"else",
+	"fn",
+	"for",
+	"if",
+	"receive",
+	"rescue",
+	"try",
+	"unless",
+	"when",
+	"with",
+}
+
+var erlangKeywords = []string{
+	"after",
+	"begin",
+	"case",
+	"catch",
+	"fun",
+	"if",
+	"maybe",
+	"receive",
+	"try",
+	"when",
+}
+
+// clojure keywords are the forms they start, as tokens are split by whitespace
+var clojureKeywords = []string{
+	"(case",
+	"(catch",
+	"(cond",
+	"(cond->",
+	"(condp",
+	"(defn",
+	"(defn-",
+	"(doseq",
+	"(fn",
+	"(for",
+	"(if",
+	"(if-let",
+	"(if-not",
+	"(loop",
+	"(match",
+	"(recur",
+	"(try",
+	"(when",
+	"(when-let",
+	"(when-not",
+	"(while",
+}
+
+var ocamlKeywords = []string{
+	"else",
+	"for",
+	"fun",
+	"function",
+	"if",
+	"match",
+	"try",
+	"when",
+	"while",
+	"with",
+}
+
+var fsharpKeywords = []string{
+	"elif",
+	"else",
+	"for",
+	"fun",
+	"function",
+	"if",
+	"match",
+	"try",
+	"when",
+	"while",
+	"with",
+}
+
+var perlKeywords = []string{
+	"die",
+	"do",
+	"else",
+	"elsif",
+	"eval",
+	"for",
+	"foreach",
+	"given",
+	"if",
+	"last",
+	"next",
+	"redo",
+	"return",
+	"sub",
+	"unless",
+	"until",
+	"when",
+	"while",
+}
+
+var luaKeywords = []string{
+	"break",
+	"else",
+	"elseif",
+	"for",
+	"function",
+	"goto",
+	"if",
+	"repeat",
+	"return",
+	"until",
+	"while",
+}
+
+var rKeywords = []string{
+	"break",
+	"else",
+	"for",
+	"function",
+	"if",
+	"next",
+	"repeat",
+	"return",
+	"switch",
+	"tryCatch",
+	"while",
+}
+
+var juliaKeywords = []string{
+	"break",
+	"catch",
+	"continue",
+	"do",
+	"else",
+	"elseif",
+	"finally",
+	"for",
+	"function",
+	"if",
+	"macro",
+	"return",
+	"try",
+	"while",
+}
+
+var dartKeywords = []string{
+	"assert",
+	"async",
+	"await",
+	"break",
+	"case",
+	"catch",
+	"class",
+	"continue",
+	"do",
+	"else",
+	"enum",
+	"extends",
+	"finally",
+	"for",
+	"if",
+	"implements",
+	"mixin",
+	"return",
+	"switch",
+	"throw",
+	"try",
+	"while",
+	"with",
+	"yield",
+}
+
+var zigKeywords = []string{
+	"break",
+	"catch",
+	"continue",
+	"defer",
+	"else",
+	"errdefer",
+	"for",
+	"if",
+	"orelse",
+	"return",
+	"switch",
+	"try",
+	"while",
+}
+
+var nimKeywords = []string{
+	"break",
+	"case",
+	"continue",
+	"elif",
+	"else",
+	"except",
+	"finally",
+	"for",
+	"func",
+	"if",
+	"iterator",
+	"method",
+	"of",
+	"proc",
+	"raise",
+	"return",
+	"try",
+	"when",
+	"while",
+	"yield",
+}
+
+var dKeywords = []string{
+	"break",
+	"case",
+	"catch",
+	"continue",
+	"do",
+	"else",
+	"finally",
+	"for",
+	"foreach",
+	"foreach_reverse",
+	"goto",
+	"if",
+	"return",
+	"scope",
+	"switch",
+	"throw",
+	"try",
+	"while",
+}
+
+var solidityKeywords = []string{
+	"assert",
+	"break",
+	"catch",
+	"continue",
+	"do",
+	"else",
+	"for",
+	"if",
+	"modifier",
+	"require",
+	"return",
+	"revert",
+	"try",
+	"while",
+}
+
+var verilogKeywords = []string{
+	"always",
+	"always_comb",
+	"always_ff",
+	"always_latch",
+	"case",
+	"casex",
+	"casez",
+	"else",
+	"for",
+	"foreach",
+	"forever",
+	"generate",
+	"if",
+	"initial",
+	"repeat",
+	"while",
+}
+
+var vhdlKeywords = []string{
+	"case",
+	"else",
+	"elsif",
+	"exit",
+	"for",
+	"generate",
+	"if",
+	"loop",
+	"next",
+	"process",
+	"return",
+	"wait",
+	"when",
+	"while",
+}
+
+// hclKeywords are the meta-arguments of terraform, and the expressions and template directives of hcl
+var hclKeywords = []string{
+	"count",
+	"depends_on",
+	"dynamic",
+	"else",
+	"for",
+	"for_each",
+	"if",
+	"in",
+	"lifecycle",
+	"postcondition",
+	"precondition",
+	"provider",
+}
+
+var bicepKeywords = []string{
+	"assert",
+	"existing",
+	"for",
+	"func",
+	"if",
+	"in",
+}
+
+var starlarkKeywords = []string{
+	"and",
+	"break",
+	"continue",
+	"def",
+	"elif",
+	"else",
+	"for",
+	"if",
+	"in",
+	"lambda",
+	"load",
+	"not",
+	"or",
+	"return",
+}
+
+var matlabKeywords = []string{
+	"break",
+	"case",
+	"catch",
+	"classdef",
+	"continue",
+	"else",
+	"elseif",
+	"for",
+	"function",
+	"if",
+	"otherwise",
+	"parfor",
+	"return",
+	"switch",
+	"try",
+	"while",
+}
+
+var cobolKeywords = []string{
+	"call",
+	"else",
+	"evaluate",
+	"go",
+	"if",
+	"perform",
+	"search",
+	"when",
+}
+
+var adaKeywords = []string{
+	"accept",
+	"case",
+	"declare",
+	"else",
+	"elsif",
+	"exception",
+	"exit",
+	"for",
+	"goto",
+	"if",
+	"loop",
+	"raise",
+	"return",
+	"select",
+	"when",
+	"while",
+}
+
+var pascalKeywords = []string{
+	"break",
+	"case",
+	"continue",
+	"else",
+	"except",
+	"exit",
+	"finally",
+	"for",
+	"goto",
+	"if",
+	"raise",
+	"repeat",
+	"try",
+	"while",
+	"with",
+}
+
+var vbnetKeywords = []string{
+	"case",
+	"catch",
+	"continue",
+	"do",
+	"else",
+	"elseif",
+	"exit",
+	"finally",
+	"for",
+	"goto",
+	"if",
+	"return",
+	"select",
+	"throw",
+	"try",
+	"while",
+}
+
+var abapKeywords = []string{
+	"case",
+	"catch",
+	"check",
+	"cleanup",
+	"continue",
+	"do",
+	"else",
+	"elseif",
+	"exit",
+	"if",
+	"loop",
+	"raise",
+	"return",
+	"try",
+	"when",
+	"while",
+}
+
+var fortranKeywords = []string{
+	"abstract",
+	"allocatable",
+	"allocate",
+	"assign",
+	"associate",
+	"asynchronous",
+	"backspace",
+	"block",
+	"block data",
+	"case",
+	"codimension",
+	"common",
+	"contains",
+	"contiguous",
+	"critical",
+	"cycle",
+	"data",
+	"deallocate",
+	"deferred",
+	"do",
+	"do concurrent",
+	"else",
+	"else if",
+	"end",
+	"endfile",
+	"endif",
+	"entry",
+	"equivalence",
+	"external",
+	"final",
+	"flush",
+	"format",
+	"forall",
+	"function",
+	"generic",
+	"goto",
+	"if",
+	"implicit",
+	"include",
+	"inquire",
+	"intrinsic",
+	"lock",
+	"module",
+	"namelist",
+	"nullify",
+	"only",
+	"operator",
+	"optional",
+	"pause",
+	"pass",
+	"pointer",
+	"procedure",
+	"program",
+	"private",
+	"public",
+	"recursive",
+	"result",
+	"rewrite",
+	"save",
+	"select",
+	"select rank",
+	"sequence",
+	"stop",
+	"submodule",
+	"subroutine",
+	"sync all",
+	"sync images",
+	"sync memory",
+	"target",
+	"then",
+	"use",
+	"volatile",
+	"wait",
+	"while",
+	"write",
+	"impure",
+	"error stop",
+	"non_overridable",
+	"non_recursive",
+	"import",
+	"element",
+	"elemental",
+	"extend",
+	"enumerator",
 }
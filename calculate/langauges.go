@@ -1,40 +1,740 @@
 package calculate
 
+import (
+	"code-complexity/options"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
 type Language = string
 
-var languageToExtensions = map[Language][]string{
-	"java":       {"java"},
-	"csharp":     {"cs", "cshtml"},
-	"node":       {"js", "jsx", "ts", "tsx"},
-	"python":     {"py", "py3", "py2"},
-	"kotlin":     {"kt", "kts", "ktm"},
-	"c":          {"c", "h"},
-	"cpp":        {"cpp", "cxx", "cc", "hpp", "hh", "txx", "tpp"},
-	"objectivec": {"m", "mm"},
-	"swift":      {"swift"},
-	"ruby":       {"rb"},
-	"go":         {"go"},
-	"rust":       {"rs"},
-	"scala":      {"scala", "sc"},
-	"php":        {"php", "phtml", "php3", "php4", "php5", "php7", "phps", "pht", "phar"},
-	"fortran":    {"f", "for", "f77", "f90", "f95", "f03", "f03p", "f08", "f08p", "f15", "f20", "f18", "f2k", "f2003", "f2008", "f2015", "f2018", "fpp", "ftn", "f05", "F", "FOR", "F77", "F90", "F95", "F03", "F08", "F15", "F18", "F2K", "F2003", "F2015", "F2008", "F2018", "FPP", "FTN"},
-}
-
-var extensionToLanguage = make(map[Language]string)
+type LanguageDefinition = options.LanguageDefinition
+
+type BlockComment = options.BlockComment
+
+type Region = options.Region
+
+type ColumnComment = options.ColumnComment
+
+type HereString = options.HereString
+
+// every built-in language treats lines starting with these as comments, whether or not the language has them
+var (
+	defaultLineComments     = []string{"//", "#"}
+	defaultBlockComments    = []BlockComment{{Start: "/*", End: "*/"}}
+	defaultStringDelimiters = []string{"\"", "'", "`"}
+)
+
+var builtinLanguages = []LanguageDefinition{
+	{Name: "java", Extensions: []string{"java"}, Keywords: javaKeywords, Operators: cOperators, Braces: true, AtSignKeywords: true},
+	{Name: "csharp", Extensions: []string{"cs"}, Keywords: cSharpKeywords, Operators: nullSafeOperators, Braces: true},
+	{
+		Name:           "javascript",
+		Extensions:     []string{"js", "jsx", "mjs", "cjs"},
+		Interpreters:   []string{"node", "nodejs"},
+		Keywords:       nodeKeywords,
+		Operators:      nullSafeOperators,
+		Braces:         true,
+		AtSignKeywords: true,
+		Jsx:            true,
+		Rollup:         "node",
+	},
+	{
+		Name:           "typescript",
+		Extensions:     []string{"ts", "tsx", "mts", "cts"},
+		Interpreters:   []string{"deno", "bun", "ts-node", "tsx"},
+		Keywords:       typescriptKeywords,
+		Operators:      nullSafeOperators,
+		Braces:         true,
+		AtSignKeywords: true,
+		Jsx:            true,
+		Rollup:         "node",
+	},
+	// node has no files of its own, it sums javascript and typescript, and counts sources given as node explicitly
+	{Name: "node", Keywords: nodeKeywords, Operators: nullSafeOperators, Braces: true, AtSignKeywords: true},
+	{
+		Name:         "python",
+		Extensions:   []string{"py", "py3", "py2"},
+		Filenames:    []string{"SConstruct", "SConscript"},
+		Interpreters: []string{"python", "pypy"},
+		BlockComments: []BlockComment{
+			{Start: "/*", End: "*/"},
+			{Start: "\"\"\"", End: "\"\"\""},
+		},
+		Keywords:       pythonKeywords,
+		Operators:      wordOperators,
+		AtSignKeywords: true,
+	},
+	{Name: "kotlin", Extensions: []string{"kt", "kts", "ktm"}, Keywords: kotlinKeywords, Operators: kotlinOperators, Braces: true, AtSignKeywords: true},
+	{Name: "c", Extensions: []string{"c", "h"}, Keywords: cKeywords, Operators: cOperators, Braces: true},
+	{Name: "cpp", Extensions: []string{"cpp", "cxx", "cc", "hpp", "hh", "txx", "tpp"}, Keywords: cppKeywords, Operators: cOperators, Braces: true},
+	{Name: "objectivec", Extensions: []string{"m", "mm"}, Keywords: objectiveCKeywords, Operators: cOperators, Braces: true, AtSignKeywords: true},
+	{Name: "swift", Extensions: []string{"swift"}, Keywords: swiftKeywords, Operators: nullSafeOperators, Braces: true},
+	{
+		Name:         "ruby",
+		Extensions:   []string{"rb", "rake", "gemspec"},
+		Filenames:    []string{"Rakefile", "Gemfile", "Podfile", "Fastfile", "Guardfile", "Vagrantfile", "Brewfile"},
+		Interpreters: []string{"ruby", "jruby"},
+		BlockComments: []BlockComment{
+			{Start: "/*", End: "*/"},
+			{Start: "=begin", End: "=end", LineStart: true},
+			{Start: "<<-DOC", End: "DOC"},
+		},
+		Keywords:  rubyKeywords,
+		Operators: rubyOperators,
+	},
+	{
+		Name:             "go",
+		Extensions:       []string{"go"},
+		Keywords:         goKeywords,
+		Operators:        logicalOperators,
+		Braces:           true,
+		BlockParentheses: []string{"import", "const", "var", "type"},
+	},
+	{Name: "rust", Extensions: []string{"rs"}, CharLiterals: true, Keywords: rustKeywords, Operators: logicalOperators, Braces: true},
+	{Name: "scala", Extensions: []string{"scala", "sc"}, Keywords: scalaKeywords, Operators: logicalOperators, Braces: true, AtSignKeywords: true},
+	{
+		Name:         "php",
+		Extensions:   []string{"php", "phtml", "php3", "php4", "php5", "php7", "phps", "pht", "phar"},
+		Interpreters: []string{"php"},
+		Keywords:     phpKeywords,
+		Operators:    phpOperators,
+		Braces:       true,
+	},
+	{
+		Name:           "groovy",
+		Extensions:     []string{"groovy", "gvy", "gy", "gsh"},
+		Filenames:      []string{"Jenkinsfile"},
+		Interpreters:   []string{"groovy"},
+		Keywords:       groovyKeywords,
+		Operators:      groovyOperators,
+		Braces:         true,
+		AtSignKeywords: true,
+	},
+	{
+		Name:             "shell",
+		Extensions:       []string{"sh", "bash", "zsh", "ksh"},
+		Filenames:        []string{".bashrc", ".bash_profile", ".zshrc", ".profile"},
+		Interpreters:     []string{"sh", "bash", "zsh", "ksh", "dash", "ash"},
+		LineComments:     []string{"#"},
+		BlockComments:    []BlockComment{},
+		StringDelimiters: []string{"\"", "'", "`"},
+		Keywords:         shellKeywords,
+		Operators:        logicalOperators,
+		Heredocs:         true,
+		Commands:         true,
+	},
+	{
+		Name:             "powershell",
+		Extensions:       []string{"ps1", "psm1", "psd1"},
+		Interpreters:     []string{"pwsh", "powershell"},
+		LineComments:     []string{"#"},
+		BlockComments:    []BlockComment{{Start: "<#", End: "#>"}},
+		StringDelimiters: []string{"\"", "'"},
+		Keywords:         powershellKeywords,
+		Operators:        powershellOperators,
+		Braces:           true,
+		HereStrings:      []HereString{{Start: "@\"", End: "\"@"}, {Start: "@'", End: "'@"}},
+		// e.g. ForEach or Function
+		CaseInsensitiveKeywords: true,
+	},
+	{
+		Name:                    "sql",
+		Extensions:              []string{"sql", "ddl", "pls", "plsql", "pks", "pkb", "pck", "tsql", "pgsql"},
+		LineComments:            []string{"--"},
+		BlockComments:           []BlockComment{{Start: "/*", End: "*/"}},
+		StringDelimiters:        []string{"'", "\""},
+		Keywords:                sqlKeywords,
+		CaseInsensitiveKeywords: true,
+	},
+	// sql dialects, only detected with the sql-dialects flag, see extensionToDisambiguation
+	sqlDialect("plsql"),
+	sqlDialect("tsql"),
+	sqlDialect("plpgsql"),
+	{
+		Name:             "haskell",
+		Extensions:       []string{"hs", "lhs"},
+		Interpreters:     []string{"runhaskell", "runghc"},
+		LineComments:     []string{"--"},
+		BlockComments:    []BlockComment{{Start: "{-", End: "-}", Nested: true}},
+		StringDelimiters: []string{"\""},
+		Keywords:         haskellKeywords,
+		Operators:        logicalOperators,
+	},
+	{
+		Name:         "elixir",
+		Extensions:   []string{"ex", "exs"},
+		Interpreters: []string{"elixir"},
+		LineComments: []string{"#"},
+		// @doc and @moduledoc heredocs
+		BlockComments:    []BlockComment{{Start: "\"\"\"", End: "\"\"\""}},
+		StringDelimiters: []string{"\"", "'"},
+		Keywords:         elixirKeywords,
+		Operators:        elixirOperators,
+	},
+	{
+		Name:             "erlang",
+		Extensions:       []string{"erl", "hrl"},
+		Interpreters:     []string{"escript"},
+		LineComments:     []string{"%"},
+		BlockComments:    []BlockComment{},
+		StringDelimiters: []string{"\""},
+		Keywords:         erlangKeywords,
+		Operators:        erlangOperators,
+	},
+	{
+		Name:             "clojure",
+		Extensions:       []string{"clj", "cljs", "cljc", "edn"},
+		LineComments:     []string{";"},
+		BlockComments:    []BlockComment{},
+		StringDelimiters: []string{"\""},
+		Keywords:         clojureKeywords,
+		Operators:        clojureOperators,
+		NoContinuations:  true,
+	},
+	{
+		Name:       "ocaml",
+		Extensions: []string{"ml", "mli"},
+		// no line comments
+		LineComments:     []string{},
+		BlockComments:    []BlockComment{{Start: "(*", End: "*)", Nested: true}},
+		StringDelimiters: []string{"\""},
+		Keywords:         ocamlKeywords,
+		Operators:        logicalOperators,
+	},
+	{
+		Name:             "fsharp",
+		Extensions:       []string{"fs", "fsi", "fsx"},
+		LineComments:     []string{"//"},
+		BlockComments:    []BlockComment{{Start: "(*", End: "*)", Nested: true}},
+		StringDelimiters: []string{"\""},
+		Keywords:         fsharpKeywords,
+		Operators:        logicalOperators,
+	},
+	{
+		Name:         "perl",
+		Extensions:   []string{"pl", "pm", "t", "pod"},
+		Interpreters: []string{"perl"},
+		LineComments: []string{"#"},
+		// pod blocks, from a line starting with a pod command until =cut
+		BlockComments: []BlockComment{
+			{Start: "=pod", End: "=cut", LineStart: true},
+			{Start: "=head", End: "=cut", LineStart: true},
+			{Start: "=over", End: "=cut", LineStart: true},
+			{Start: "=item", End: "=cut", LineStart: true},
+			{Start: "=begin", End: "=cut", LineStart: true},
+			{Start: "=for", End: "=cut", LineStart: true},
+			{Start: "=encoding", End: "=cut", LineStart: true},
+		},
+		StringDelimiters: []string{"\"", "'"},
+		Keywords:         perlKeywords,
+		Operators:        perlOperators,
+		Braces:           true,
+		Heredocs:         true,
+	},
+	{
+		Name:         "lua",
+		Extensions:   []string{"lua"},
+		Interpreters: []string{"lua", "luajit"},
+		LineComments: []string{"--"},
+		BlockComments: []BlockComment{
+			{Start: "--[[", End: "]]"},
+			{Start: "--[=[", End: "]=]"},
+			{Start: "--[==[", End: "]==]"},
+		},
+		StringDelimiters: []string{"\"", "'"},
+		Keywords:         luaKeywords,
+		Operators:        wordOperators,
+	},
+	{
+		Name:         "r",
+		Extensions:   []string{"r", "R"},
+		Filenames:    []string{".Rprofile"},
+		Interpreters: []string{"Rscript"},
+		// including #' roxygen docs
+		LineComments:     []string{"#"},
+		BlockComments:    []BlockComment{},
+		StringDelimiters: []string{"\"", "'"},
+		Keywords:         rKeywords,
+		Operators:        logicalOperators,
+		Braces:           true,
+	},
+	{
+		Name:             "julia",
+		Extensions:       []string{"jl"},
+		Interpreters:     []string{"julia"},
+		LineComments:     []string{"#"},
+		BlockComments:    []BlockComment{{Start: "#=", End: "=#", Nested: true}},
+		StringDelimiters: []string{"\""},
+		Keywords:         juliaKeywords,
+		Operators:        cOperators,
+	},
+	{
+		Name:             "dart",
+		Extensions:       []string{"dart"},
+		Interpreters:     []string{"dart"},
+		LineComments:     []string{"//"},
+		BlockComments:    []BlockComment{{Start: "/*", End: "*/", Nested: true}},
+		StringDelimiters: []string{"\"", "'"},
+		Keywords:         dartKeywords,
+		Operators:        nullSafeOperators,
+		Braces:           true,
+		AtSignKeywords:   true,
+	},
+	{
+		Name:             "zig",
+		Extensions:       []string{"zig", "zon"},
+		LineComments:     []string{"//"},
+		BlockComments:    []BlockComment{},
+		StringDelimiters: []string{"\"", "'"},
+		Keywords:         zigKeywords,
+		Operators:        wordOperators,
+		Braces:           true,
+	},
+	{
+		Name:         "nim",
+		Extensions:   []string{"nim", "nims", "nimble"},
+		LineComments: []string{"#"},
+		BlockComments: []BlockComment{
+			{Start: "##[", End: "]##", Nested: true},
+			{Start: "#[", End: "]#", Nested: true},
+		},
+		StringDelimiters: []string{"\"", "'"},
+		Keywords:         nimKeywords,
+		Operators:        wordOperators,
+	},
+	{
+		Name:         "d",
+		Extensions:   []string{"d", "di"},
+		LineComments: []string{"//"},
+		BlockComments: []BlockComment{
+			{Start: "/*", End: "*/"},
+			{Start: "/+", End: "+/", Nested: true},
+		},
+		Keywords:  dKeywords,
+		Operators: cOperators,
+		Braces:    true,
+	},
+	{
+		Name:         "solidity",
+		Extensions:   []string{"sol"},
+		LineComments: []string{"//"},
+		Keywords:     solidityKeywords,
+		Operators:    cOperators,
+		Braces:       true,
+	},
+	{
+		Name:         "verilog",
+		Extensions:   []string{"v", "vh", "sv", "svh"},
+		LineComments: []string{"//"},
+		// ' is of sized literals, e.g. 4'b0
+		StringDelimiters: []string{"\""},
+		Keywords:         verilogKeywords,
+		Operators:        cOperators,
+	},
+	{
+		Name:                    "vhdl",
+		Extensions:              []string{"vhd", "vhdl"},
+		LineComments:            []string{"--"},
+		StringDelimiters:        []string{"\""},
+		Keywords:                vhdlKeywords,
+		Operators:               wordOperators,
+		CaseInsensitiveKeywords: true,
+		EndKeywords:             []string{"end"},
+	},
+	{
+		Name:             "hcl",
+		Extensions:       []string{"tf", "tfvars", "hcl"},
+		LineComments:     []string{"#", "//"},
+		StringDelimiters: []string{"\""},
+		Keywords:         hclKeywords,
+		Operators:        cOperators,
+		Braces:           true,
+		Heredocs:         true,
+	},
+	{
+		Name:             "bicep",
+		Extensions:       []string{"bicep", "bicepparam"},
+		LineComments:     []string{"//"},
+		StringDelimiters: []string{"'''", "'"},
+		Keywords:         bicepKeywords,
+		Operators:        bicepOperators,
+		Braces:           true,
+	},
+	{
+		Name:          "starlark",
+		Extensions:    []string{"bzl", "bazel", "star", "sky"},
+		Filenames:     []string{"BUILD", "WORKSPACE", "Tiltfile"},
+		LineComments:  []string{"#"},
+		BlockComments: []BlockComment{{Start: "\"\"\"", End: "\"\"\""}},
+		Keywords:      starlarkKeywords,
+		Operators:     wordOperators,
+	},
+	{
+		Name:          "dockerfile",
+		Extensions:    []string{"dockerfile"},
+		Filenames:     []string{"Dockerfile", "Containerfile"},
+		LineComments:  []string{"#"},
+		BlockComments: []BlockComment{},
+		Commands:      true,
+	},
+	{
+		// m files are objectivec unless disambiguated, see extensionToDisambiguation
+		Name:         "matlab",
+		LineComments: []string{"%"},
+		// block comments are of lines of nothing but %{ and %}, otherwise %{ is a line comment
+		BlockComments:    []BlockComment{{Start: "%{", End: "%}", Nested: true, OwnLine: true}},
+		StringDelimiters: []string{"\"", "'"},
+		Keywords:         matlabKeywords,
+		Operators:        logicalOperators,
+	},
+	{
+		Name:       "vue",
+		Extensions: []string{"vue"},
+		Regions:    scriptRegions,
+		Markup:     "markup",
+	},
+	{
+		Name:       "svelte",
+		Extensions: []string{"svelte"},
+		Regions:    scriptRegions,
+		Markup:     "markup",
+	},
+	{
+		Name:       "razor",
+		Extensions: []string{"cshtml", "razor"},
+		Regions: []Region{
+			{Start: `@\*`, End: "*@"},
+			{Start: `@(?:code|functions)?\s*\{`, End: "}", Language: "csharp", Braces: true},
+			{
+				Start:    `@((?:if|else|for|foreach|while|do|switch|using|lock|try)\b[^{\n]*\{)`,
+				End:      "}",
+				Language: "csharp",
+				Braces:   true,
+			},
+		},
+		Markup: "markup",
+	},
+	{
+		Name:       "jsp",
+		Extensions: []string{"jsp", "jspf", "tag"},
+		Regions: []Region{
+			{Start: `<%--`, End: "--%>"},
+			{Start: `<%@`, End: "%>"},
+			{Start: `<%[!=]?`, End: "%>", Language: "java"},
+		},
+		Markup: "markup",
+	},
+	{
+		Name:       "erb",
+		Extensions: []string{"erb", "rhtml"},
+		Regions: []Region{
+			{Start: `<%#`, End: "%>"},
+			{Start: `<%[=-]?`, End: "%>", Language: "ruby"},
+		},
+		Markup: "markup",
+	},
+	{
+		Name:       "jupyter",
+		Extensions: []string{"ipynb"},
+		Notebook:   true,
+	},
+	{
+		// lines out of the regions of vue, svelte, razor, jsp and erb files
+		Name:             "markup",
+		LineComments:     []string{},
+		BlockComments:    []BlockComment{{Start: "<!--", End: "-->"}},
+		StringDelimiters: []string{},
+		NoContinuations:  true,
+	},
+	{
+		Name: "fortran",
+		Extensions: []string{
+			"f90", "f95", "f03", "f03p", "f08", "f08p", "f15", "f20", "f18", "f2k", "f2003", "f2008", "f2015",
+			"f2018", "f05", "F90", "F95", "F03", "F08", "F15", "F18", "F2K", "F2003", "F2015", "F2008", "F2018",
+		},
+		// // is the concatenation of strings
+		LineComments:     []string{"!"},
+		BlockComments:    []BlockComment{},
+		StringDelimiters: []string{"'", "\""},
+		Keywords:         fortranKeywords,
+		Operators:        fortranOperators,
+	},
+	{
+		// statements start at column 7, after labels and continuation marks
+		Name:                    "fortran-fixed",
+		Extensions:              []string{"f", "for", "f77", "fpp", "ftn", "F", "FOR", "F77", "FPP", "FTN"},
+		LineComments:            []string{"!"},
+		BlockComments:           []BlockComment{},
+		ColumnComments:          []ColumnComment{{Column: 1, Markers: []string{"c", "C", "*", "!"}}},
+		MarginColumns:           6,
+		StringDelimiters:        []string{"'", "\""},
+		Keywords:                fortranKeywords,
+		Operators:               fortranOperators,
+		CaseInsensitiveKeywords: true,
+		EndKeywords:             []string{"end"},
+		Rollup:                  "fortran",
+	},
+	{
+		// fixed format, with sequence numbers up to column 6 and comment indicators at column 7
+		Name:                    "cobol",
+		Extensions:              []string{"cob", "cbl", "cpy", "COB", "CBL", "CPY"},
+		LineComments:            []string{"*>"},
+		BlockComments:           []BlockComment{},
+		ColumnComments:          []ColumnComment{{Column: 7, Markers: []string{"*", "/"}}},
+		MarginColumns:           6,
+		StringDelimiters:        []string{"\"", "'"},
+		Keywords:                cobolKeywords,
+		Operators:               wordOperators,
+		CaseInsensitiveKeywords: true,
+	},
+	{
+		Name:                    "ada",
+		Extensions:              []string{"adb", "ads", "ada"},
+		LineComments:            []string{"--"},
+		BlockComments:           []BlockComment{},
+		StringDelimiters:        []string{"\""},
+		Keywords:                adaKeywords,
+		Operators:               adaOperators,
+		CaseInsensitiveKeywords: true,
+		EndKeywords:             []string{"end"},
+	},
+	{
+		Name:         "pascal",
+		Extensions:   []string{"pas", "dpr", "dpk", "lpr"},
+		LineComments: []string{"//"},
+		BlockComments: []BlockComment{
+			{Start: "{", End: "}"},
+			{Start: "(*", End: "*)"},
+		},
+		StringDelimiters:        []string{"'"},
+		Keywords:                pascalKeywords,
+		Operators:               wordOperators,
+		CaseInsensitiveKeywords: true,
+	},
+	{
+		Name:                    "vbnet",
+		Extensions:              []string{"vb"},
+		LineComments:            []string{"'", "REM ", "Rem ", "rem "},
+		BlockComments:           []BlockComment{},
+		StringDelimiters:        []string{"\""},
+		Keywords:                vbnetKeywords,
+		Operators:               vbnetOperators,
+		CaseInsensitiveKeywords: true,
+		EndKeywords:             []string{"end"},
+	},
+	{
+		Name:                    "abap",
+		Extensions:              []string{"abap"},
+		LineComments:            []string{"\""},
+		BlockComments:           []BlockComment{},
+		ColumnComments:          []ColumnComment{{Column: 1, Markers: []string{"*"}}},
+		StringDelimiters:        []string{"'", "`", "|"},
+		Keywords:                abapKeywords,
+		Operators:               wordOperators,
+		CaseInsensitiveKeywords: true,
+	},
+}
+
+// scriptRegions are the scripts of single file components, in typescript if their lang says so
+var scriptRegions = []Region{
+	{Start: `<script\b[^>]*\blang=["']?tsx?\b[^>]*>`, End: "</script>", Language: "typescript"},
+	{Start: `<script\b[^>]*>`, End: "</script>", Language: "javascript"},
+}
+
+func sqlDialect(name Language) LanguageDefinition {
+	return LanguageDefinition{
+		Name:                    name,
+		LineComments:            []string{"--"},
+		BlockComments:           []BlockComment{{Start: "/*", End: "*/"}},
+		StringDelimiters:        []string{"'", "\""},
+		Keywords:                sqlKeywords,
+		CaseInsensitiveKeywords: true,
+		Rollup:                  "sql",
+	}
+}
 
 func init() {
-	for language, extensions := range languageToExtensions {
-		for _, extension := range extensions {
-			extensionToLanguage[extension] = language
+	for i := range builtinLanguages {
+		definition := &builtinLanguages[i]
+		if definition.LineComments == nil {
+			definition.LineComments = defaultLineComments
+		}
+		if definition.BlockComments == nil {
+			definition.BlockComments = defaultBlockComments
+		}
+		if definition.StringDelimiters == nil {
+			definition.StringDelimiters = defaultStringDelimiters
 		}
 	}
+	var err error
+	builtins, err = newLanguages(nil)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// languages are the definitions an analysis detects and counts languages by
+type languages struct {
+	byName        map[Language]*LanguageDefinition
+	byExtension   map[string]*LanguageDefinition
+	byFilename    map[string]*LanguageDefinition
+	byInterpreter map[string]*LanguageDefinition
+	// hashes change whenever the counting rules of a language change
+	hashes map[Language]string
+	// regionStarts are the compiled starts of the regions of every language
+	regionStarts map[string]*regexp.Regexp
 }
 
-func tryGetLanguage(ext string) (Language, bool) {
+var builtins *languages
+
+// newLanguages adds the custom definitions to the built-in ones, replacing those with the same name, extensions or
+// filenames
+func newLanguages(custom []LanguageDefinition) (*languages, error) {
+	l := &languages{
+		byName:        make(map[Language]*LanguageDefinition),
+		byExtension:   make(map[string]*LanguageDefinition),
+		byFilename:    make(map[string]*LanguageDefinition),
+		byInterpreter: make(map[string]*LanguageDefinition),
+		hashes:        make(map[Language]string),
+		regionStarts:  make(map[string]*regexp.Regexp),
+	}
+	for i := range builtinLanguages {
+		l.byName[builtinLanguages[i].Name] = &builtinLanguages[i]
+	}
+	for i := range custom {
+		definition := custom[i]
+		if len(definition.Name) == 0 {
+			return nil, fmt.Errorf("language definition %v has no name", i+1)
+		}
+		for _, blockComment := range definition.BlockComments {
+			if len(blockComment.Start) == 0 || len(blockComment.End) == 0 {
+				return nil, fmt.Errorf("language '%v' has a block comment without start or end", definition.Name)
+			}
+		}
+		for _, columnComment := range definition.ColumnComments {
+			if columnComment.Column < 1 {
+				return nil, fmt.Errorf("language '%v' has a column comment before column 1", definition.Name)
+			}
+		}
+		for _, hereString := range definition.HereStrings {
+			if len(hereString.Start) == 0 || len(hereString.End) == 0 {
+				return nil, fmt.Errorf("language '%v' has a here-string without start or end", definition.Name)
+			}
+		}
+		l.byName[definition.Name] = &definition
+	}
+
+	// custom definitions are indexed last, taking over extensions and filenames of built-in languages
+	var indexed []*LanguageDefinition
+	for i := range builtinLanguages {
+		if l.byName[builtinLanguages[i].Name] == &builtinLanguages[i] {
+			indexed = append(indexed, &builtinLanguages[i])
+		}
+	}
+	for _, definition := range custom {
+		indexed = append(indexed, l.byName[definition.Name])
+	}
+	for _, definition := range indexed {
+		for _, extension := range definition.Extensions {
+			l.byExtension[extension] = definition
+		}
+		for _, filename := range definition.Filenames {
+			l.byFilename[filename] = definition
+		}
+		for _, interpreter := range definition.Interpreters {
+			l.byInterpreter[interpreter] = definition
+		}
+	}
+
+	for name, definition := range l.byName {
+		err := l.compileRegions(definition)
+		if err != nil {
+			return nil, err
+		}
+		asJson, err := json.Marshal(definition)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize language '%v': %v", name, err)
+		}
+		hash := sha256.Sum256(asJson)
+		l.hashes[name] = hex.EncodeToString(hash[:])
+	}
+	return l, nil
+}
+
+// compileRegions checks that the regions and markup of a definition name supported languages, and compiles their
+// starts
+func (l *languages) compileRegions(definition *LanguageDefinition) error {
+	if _, found := l.byName[definition.Markup]; len(definition.Markup) > 0 && !found {
+		return fmt.Errorf("language '%v' has an unknown markup language '%v'", definition.Name, definition.Markup)
+	}
+	for _, region := range definition.Regions {
+		if len(region.Start) == 0 || len(region.End) == 0 {
+			return fmt.Errorf("language '%v' has a region without start or end", definition.Name)
+		}
+		if _, found := l.byName[region.Language]; len(region.Language) > 0 && !found {
+			return fmt.Errorf("language '%v' has a region of unknown language '%v'", definition.Name, region.Language)
+		}
+		if _, compiled := l.regionStarts[region.Start]; compiled {
+			continue
+		}
+		start, err := regexp.Compile(region.Start)
+		if err != nil {
+			return fmt.Errorf("language '%v' has an invalid region start: %v", definition.Name, err)
+		}
+		l.regionStarts[region.Start] = start
+	}
+	return nil
+}
+
+// detect finds the language of a file by its name, then by its extension
+func (l *languages) detect(filePath string) (*LanguageDefinition, bool) {
+	fileName := filepath.Base(filePath)
+	if definition, found := l.byFilename[fileName]; found {
+		return definition, true
+	}
+	ext := filepath.Ext(fileName)
 	if len(ext) == 0 {
-		return "", false
+		return nil, false
+	}
+	definition, found := l.byExtension[ext[1:]]
+	return definition, found
+}
+
+// isScript is whether the language of a file may be detected by its shebang
+func isScript(filePath string) bool {
+	return len(filepath.Ext(filepath.Base(filePath))) == 0
+}
+
+var versionSuffix = regexp.MustCompile(`[\d.]+$`)
+
+// detectShebang finds the language of a script by the interpreter in its first line, e.g. #!/usr/bin/env python3
+func (l *languages) detectShebang(content []byte) (*LanguageDefinition, bool) {
+	firstLine, _, _ := strings.Cut(string(content), "\n")
+	if !strings.HasPrefix(firstLine, "#!") {
+		return nil, false
+	}
+	fields := strings.Fields(firstLine[2:])
+	if len(fields) > 0 && path.Base(fields[0]) == "env" {
+		// #!/usr/bin/env -S python3 -u or #!/usr/bin/env LANG=C ruby
+		fields = fields[1:]
+		for len(fields) > 0 && (strings.HasPrefix(fields[0], "-") || strings.Contains(fields[0], "=")) {
+			fields = fields[1:]
+		}
+	}
+	if len(fields) == 0 {
+		return nil, false
+	}
+	interpreter := path.Base(fields[0])
+	if definition, found := l.byInterpreter[interpreter]; found {
+		return definition, true
 	}
-	ext = ext[1:]
-	language, found := extensionToLanguage[ext]
-	return language, found
+	definition, found := l.byInterpreter[versionSuffix.ReplaceAllString(interpreter, "")]
+	return definition, found
 }
@@ -0,0 +1,76 @@
+package calculate
+
+import "strings"
+
+// defaultMaxNesting is the nesting depth lines are counted as deep beyond, see the max-nesting flag
+const defaultMaxNesting = 4
+
+// nestingCounter finds the nesting depth of every line of code, by braces in languages with brace blocks, otherwise
+// by indentation levels, which also matches the blocks of end keywords, e.g. in ruby
+type nestingCounter struct {
+	definition *LanguageDefinition
+	// depth is the brace depth after the last line
+	depth int
+	// indentations are the indentations of the enclosing levels, the first one is the top level
+	indentations []int
+}
+
+func newNestingCounter(definition *LanguageDefinition) *nestingCounter {
+	return &nestingCounter{definition: definition}
+}
+
+// lineDepth is the depth of the line, which is the depth of its block rather than of the blocks it opens or closes, e.g.
+// } else { is at the depth of the if. A continuation line is at the depth of the line it continues, whatever its
+// indentation
+func (n *nestingCounter) lineDepth(cleanLine string, indentation int, continuation bool) int {
+	if n.definition.Braces {
+		return n.braceDepth(cleanLine)
+	}
+	if continuation {
+		if len(n.indentations) == 0 {
+			return 0
+		}
+		return len(n.indentations) - 1
+	}
+	for len(n.indentations) > 0 && n.indentations[len(n.indentations)-1] > indentation {
+		n.indentations = n.indentations[:len(n.indentations)-1]
+	}
+	if len(n.indentations) == 0 || n.indentations[len(n.indentations)-1] < indentation {
+		n.indentations = append(n.indentations, indentation)
+	}
+	return len(n.indentations) - 1
+}
+
+func (n *nestingCounter) braceDepth(cleanLine string) int {
+	code := stripStringsAndComments(cleanLine, n.definition)
+	// the braces the line starts with close blocks before it, e.g. } or })
+	depth := n.depth - strings.Count(code[:len(code)-len(strings.TrimLeft(code, "})] \t"))], "}")
+	for _, c := range code {
+		switch c {
+		case '{':
+			n.depth++
+		case '}':
+			if n.depth > 0 {
+				n.depth--
+			}
+		}
+	}
+	if depth < 0 {
+		return 0
+	}
+	return depth
+}
+
+// addNesting counts the depth of a line in the counters
+func (counters *CodeCounters) addNesting(depth int, maxNesting int) {
+	for len(counters.NestingHistogram) <= depth {
+		counters.NestingHistogram = append(counters.NestingHistogram, 0)
+	}
+	counters.NestingHistogram[depth]++
+	if float64(depth) > counters.MaxNesting {
+		counters.MaxNesting = float64(depth)
+	}
+	if depth > maxNesting {
+		counters.DeepLines++
+	}
+}
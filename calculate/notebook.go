@@ -0,0 +1,166 @@
+package calculate
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// notebook is the part of a jupyter notebook that is counted, see https://nbformat.readthedocs.io
+type notebook struct {
+	Metadata struct {
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+		Kernelspec struct {
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+	} `json:"metadata"`
+	Cells []notebookCell `json:"cells"`
+}
+
+type notebookCell struct {
+	CellType string         `json:"cell_type"`
+	Source   notebookSource `json:"source"`
+}
+
+// notebookSource is either a string or a list of lines, each ending with its own new line
+type notebookSource string
+
+func (source *notebookSource) UnmarshalJSON(data []byte) error {
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err == nil {
+		*source = notebookSource(strings.Join(lines, ""))
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	*source = notebookSource(text)
+	return nil
+}
+
+// kernelLanguages are the languages of kernels named other than by the language, by the lower case name
+var kernelLanguages = map[string]Language{
+	"c++":        "cpp",
+	"c#":         "csharp",
+	"f#":         "fsharp",
+	"bash":       "shell",
+	"sh":         "shell",
+	"zsh":        "shell",
+	"pwsh":       "powershell",
+	"octave":     "matlab",
+	"ecmascript": "javascript",
+}
+
+// defaultKernelLanguage is the language of notebooks without kernel metadata
+const defaultKernelLanguage = "python"
+
+// notebookCode is the code of every code cell of a notebook, in the language of its kernel
+type notebookCode struct {
+	language Language
+	// cells are the code of every cell, empty for markdown and raw cells
+	cells []string
+}
+
+// parseNotebook finds the code of a notebook, failing if the language of its kernel is not supported
+func (l *languages) parseNotebook(content string) (*notebookCode, error) {
+	parsed := &notebook{}
+	err := json.Unmarshal([]byte(content), parsed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse notebook: %v", err)
+	}
+
+	kernel := parsed.Metadata.LanguageInfo.Name
+	if len(kernel) == 0 {
+		kernel = parsed.Metadata.Kernelspec.Language
+	}
+	language := Language(strings.ToLower(kernel))
+	if kernelLanguage, found := kernelLanguages[language]; found {
+		language = kernelLanguage
+	}
+	if len(language) == 0 {
+		language = defaultKernelLanguage
+	}
+	if _, supported := l.byName[language]; !supported {
+		return nil, fmt.Errorf("kernel language '%v' is not supported", kernel)
+	}
+
+	code := &notebookCode{language: language}
+	for _, cell := range parsed.Cells {
+		if cell.CellType == "code" {
+			code.cells = append(code.cells, strings.TrimSuffix(string(cell.Source), "\n"))
+		} else {
+			code.cells = append(code.cells, "")
+		}
+	}
+	return code, nil
+}
+
+// code is the code cells as if they were a single file
+func (code *notebookCode) code() string {
+	var cells []string
+	for _, cell := range code.cells {
+		if len(cell) > 0 {
+			cells = append(cells, cell)
+		}
+	}
+	return strings.Join(cells, "\n")
+}
+
+// visitNotebook counts the code cells of a notebook as the language of its kernel
+func (a *analyzer) visitNotebook(path string, fileBytes []byte) error {
+	content, err := decode(path, fileBytes)
+	if err != nil {
+		return err
+	}
+	notebookCode, err := a.languages.parseNotebook(content)
+	if err != nil {
+		a.verboseLog("--- notebook '%v' is skipped: %v", path, err)
+		return nil
+	}
+	a.verboseLog("~~~ notebook '%v' is %v by its kernel", path, notebookCode.language)
+
+	code := notebookCode.code()
+	fileCounters, err := a.getCachedCounters(path, []byte(code), notebookCode.language, func() (string, error) {
+		return code, nil
+	})
+	if err != nil {
+		return err
+	}
+	a.verboseLog("+++ '%v': %v", path, fileCounters)
+
+	a.add(path, notebookCode.language, fileCounters)
+	return nil
+}
+
+// analyzeNotebook summarizes the code cells of a notebook together, and every code cell by itself
+func (a *analyzer) analyzeNotebook(path string, content string) (*FileSummary, error) {
+	notebookCode, err := a.languages.parseNotebook(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to analyze notebook at %v: %v", path, err)
+	}
+	counters, err := a.getCountersForCode(notebookCode.code(), notebookCode.language, a.tabWidth(path, notebookCode.language))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count at %v: %v", path, err)
+	}
+	fileCounters := FileCounters(*counters)
+	summary := &FileSummary{
+		Path:     path,
+		Language: notebookCode.language,
+		Counters: &fileCounters,
+	}
+	for i, cell := range notebookCode.cells {
+		if len(cell) == 0 {
+			continue
+		}
+		counters, err := a.getCountersForCode(cell, notebookCode.language, a.tabWidth(path, notebookCode.language))
+		if err != nil {
+			return nil, fmt.Errorf("failed to count cell %v at %v: %v", i+1, path, err)
+		}
+		cellCounters := FileCounters(*counters)
+		summary.Cells = append(summary.Cells, &CellSummary{Cell: i + 1, Counters: &cellCounters})
+	}
+	return summary, nil
+}
@@ -0,0 +1,144 @@
+package calculate
+
+import (
+	"sort"
+	"strings"
+)
+
+// operatorMatcher counts every decision operator of a language in lines out of strings, e.g. each && of a && b && c
+type operatorMatcher struct {
+	// phrases are the operators by their first byte, longest first
+	phrases          map[byte][]keywordPhrase
+	stringDelimiters []string
+	charLiterals     bool
+	caseInsensitive  bool
+}
+
+func newOperatorMatcher(definition *LanguageDefinition) *operatorMatcher {
+	m := &operatorMatcher{
+		phrases:          make(map[byte][]keywordPhrase),
+		stringDelimiters: definition.StringDelimiters,
+		charLiterals:     definition.CharLiterals,
+		caseInsensitive:  definition.CaseInsensitiveKeywords,
+	}
+	for _, operator := range definition.Operators {
+		if m.caseInsensitive {
+			operator = strings.ToLower(operator)
+		}
+		words := strings.Fields(operator)
+		if len(words) == 0 {
+			continue
+		}
+		m.phrases[operator[0]] = append(m.phrases[operator[0]], keywordPhrase{keyword: operator, words: words})
+	}
+	for _, phrases := range m.phrases {
+		sort.SliceStable(phrases, func(i, j int) bool {
+			return len(phrases[i].keyword) > len(phrases[j].keyword)
+		})
+	}
+	return m
+}
+
+// count is the number of operators in the line, the longest at every position, e.g. ?? rather than ?
+func (m *operatorMatcher) count(line string) float64 {
+	if len(m.phrases) == 0 {
+		return 0
+	}
+	if m.caseInsensitive {
+		line = strings.ToLower(line)
+	}
+	operatorsCount := float64(0)
+	for i := 0; i < len(line); {
+		if delimiter := stringDelimiterAt(line, i, m.stringDelimiters, m.charLiterals); len(delimiter) > 0 {
+			i = skipString(line, i, delimiter) + 1
+			continue
+		}
+		if isWordByte(line[i]) && hasWordBefore(line, i) {
+			i++
+			continue
+		}
+		end := m.matchAt(line, i)
+		if end == -1 {
+			i++
+			continue
+		}
+		operatorsCount++
+		i = end
+	}
+	return operatorsCount
+}
+
+// matchAt is the end of the longest operator at i, or -1 if none
+func (m *operatorMatcher) matchAt(line string, i int) int {
+	for _, phrase := range m.phrases[line[i]] {
+		if end := phrase.matchAt(line, i); end != -1 && (phrase.keyword != "?" || isTernary(line, i)) {
+			return end
+		}
+	}
+	return -1
+}
+
+// isTernary is whether the ? at i is a conditional, not a type, e.g. int? or <?>, or an optional member, e.g. x?: T
+func isTernary(line string, i int) bool {
+	if i > 0 && line[i-1] == '<' {
+		return false
+	}
+	if i+1 == len(line) {
+		// the condition of a ternary that goes on in the next line, unless it is the type ending a declaration
+		return i > 0 && (line[i-1] == ' ' || line[i-1] == '\t' || line[i-1] == ')')
+	}
+	if strings.IndexByte(">,)]:;?\"'", line[i+1]) >= 0 {
+		return false
+	}
+	attached := i > 0 && (isWordByte(line[i-1]) || line[i-1] == '>' || line[i-1] == ']')
+	return !attached || strings.IndexByte(" \t=[", line[i+1]) == -1
+}
+
+// stringDelimiterAt is the delimiter of the string that starts at i, or empty if none does. With charLiterals a ' starts
+// a string only as a char literal, e.g. not the lifetime 'a in rust
+func stringDelimiterAt(line string, i int, stringDelimiters []string, charLiterals bool) string {
+	for _, delimiter := range stringDelimiters {
+		if len(delimiter) > 0 && strings.HasPrefix(line[i:], delimiter) {
+			if charLiterals && delimiter == "'" && !isCharLiteral(line[i:]) {
+				return ""
+			}
+			return delimiter
+		}
+	}
+	return ""
+}
+
+var cOperators = []string{"&&", "||", "?"}
+
+var logicalOperators = []string{"&&", "||"}
+
+// nullSafeOperators are of languages with null coalescing and optional chaining, e.g. a ?? b and a?.b
+var nullSafeOperators = []string{"&&", "||", "?", "??", "?."}
+
+var wordOperators = []string{"and", "or"}
+
+var kotlinOperators = []string{"&&", "||", "?:", "?."}
+
+var rubyOperators = []string{"&&", "||", "?", "&.", "and", "or"}
+
+var phpOperators = []string{"&&", "||", "?", "?:", "??", "?->", "and", "or"}
+
+var groovyOperators = []string{"&&", "||", "?", "?:", "?."}
+
+var powershellOperators = []string{"&&", "||", "-and", "-or"}
+
+var elixirOperators = []string{"&&", "||", "and", "or"}
+
+var erlangOperators = []string{"andalso", "orelse"}
+
+var clojureOperators = []string{"(and", "(or"}
+
+var perlOperators = []string{"&&", "||", "?", "and", "or"}
+
+var bicepOperators = []string{"&&", "||", "?", "??"}
+
+var fortranOperators = []string{".and.", ".or.", ".AND.", ".OR."}
+
+var adaOperators = []string{"and then", "or else", "and", "or"}
+
+var vbnetOperators = []string{"AndAlso", "OrElse", "And", "Or"}
@@ -0,0 +1,147 @@
+package calculate
+
+import (
+	"strings"
+)
+
+// regionCode is the code of all regions of a language in a file, or of its markup
+type regionCode struct {
+	language Language
+	code     string
+}
+
+// splitRegions splits the content of a file in a language with regions into the code of every language in it, in the
+// order they first appear, the markup last
+func (l *languages) splitRegions(content string, definition *LanguageDefinition) []regionCode {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	// regions are blanked out of the markup, keeping the lines and the columns of the rest
+	markup := []byte(content)
+	var languages []Language
+	codes := make(map[Language][]string)
+
+	// matches are the next match of every region, found again only once passed
+	matches := make([][]int, len(definition.Regions))
+	for i := range matches {
+		matches[i] = []int{-1}
+	}
+	for position := 0; position < len(content); {
+		var region *Region
+		var match []int
+		for i := range definition.Regions {
+			if matches[i] != nil && matches[i][0] < position {
+				matches[i] = l.regionStarts[definition.Regions[i].Start].FindStringSubmatchIndex(content[position:])
+				for j := range matches[i] {
+					if matches[i][j] >= 0 {
+						matches[i][j] += position
+					}
+				}
+			}
+			if matches[i] != nil && (match == nil || matches[i][0] < match[0]) {
+				region, match = &definition.Regions[i], matches[i]
+			}
+		}
+		if region == nil {
+			break
+		}
+
+		codeStart, codeEnd, regionEnd := match[1], len(content), len(content)
+		end := l.findRegionEnd(content, match, region)
+		if end >= 0 {
+			codeEnd, regionEnd = end, end+len(region.End)
+		}
+		if len(match) > 2 && match[2] >= 0 {
+			codeStart, codeEnd = match[2], regionEnd
+		}
+		for i := match[0]; i < regionEnd; i++ {
+			if markup[i] != '\n' {
+				markup[i] = ' '
+			}
+		}
+		if len(region.Language) > 0 {
+			if _, found := codes[region.Language]; !found {
+				languages = append(languages, region.Language)
+			}
+			codes[region.Language] = append(codes[region.Language], regionLines(content, codeStart, codeEnd)...)
+		}
+		position = regionEnd
+	}
+
+	var regionCodes []regionCode
+	for _, language := range languages {
+		regionCodes = append(regionCodes, regionCode{language: language, code: strings.Join(codes[language], "\n")})
+	}
+	if len(definition.Markup) > 0 {
+		var markupLines []string
+		lines := strings.Split(content, "\n")
+		for i, line := range strings.Split(string(markup), "\n") {
+			// lines only of regions are not markup
+			if len(strings.TrimSpace(line)) > 0 || len(strings.TrimSpace(lines[i])) == 0 {
+				markupLines = append(markupLines, line)
+			}
+		}
+		if len(strings.TrimSpace(string(markup))) > 0 {
+			regionCodes = append(regionCodes, regionCode{language: definition.Markup, code: strings.Join(markupLines, "\n")})
+		}
+	}
+	return regionCodes
+}
+
+// findRegionEnd is the index of the end of the region that starts with match, or -1 if it is not ended
+func (l *languages) findRegionEnd(content string, match []int, region *Region) int {
+	if !region.Braces {
+		end := strings.Index(content[match[1]:], region.End)
+		if end == -1 {
+			return -1
+		}
+		return match[1] + end
+	}
+
+	var stringDelimiters []string
+	if definition, found := l.byName[region.Language]; found {
+		stringDelimiters = definition.StringDelimiters
+	}
+	depth := strings.Count(content[match[0]:match[1]], "{")
+	for i := match[1]; i < len(content); i++ {
+		if strings.HasPrefix(content[i:], region.End) && depth <= 1 {
+			return i
+		}
+		switch content[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		default:
+			for _, delimiter := range stringDelimiters {
+				if len(delimiter) > 0 && strings.HasPrefix(content[i:], delimiter) {
+					lineEnd := strings.IndexByte(content[i:], '\n')
+					if lineEnd == -1 {
+						lineEnd = len(content) - i
+					}
+					i += skipString(content[i:i+lineEnd], 0, delimiter)
+					break
+				}
+			}
+		}
+	}
+	return -1
+}
+
+// regionLines are the lines of the code between start and end, indented by the column it starts at, without the blank
+// lines left by the start and end of the region
+func regionLines(content string, start int, end int) []string {
+	lineStart := strings.LastIndexByte(content[:start], '\n') + 1
+	column := strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return r
+		}
+		return ' '
+	}, content[lineStart:start])
+	lines := strings.Split(column+content[start:end], "\n")
+	if len(lines) > 1 && len(strings.TrimSpace(lines[0])) == 0 {
+		lines = lines[1:]
+	}
+	if len(lines) > 1 && len(strings.TrimSpace(lines[len(lines)-1])) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
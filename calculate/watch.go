@@ -0,0 +1,128 @@
+package calculate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce collects the events of e.g. a branch checkout into a single update
+const watchDebounce = 200 * time.Millisecond
+
+// Watch analyzes the directory at codePath, then keeps the summary up to date by re-analyzing only the files that
+// change. onUpdate is called with a copy of the summary after the first scan and after every batch of changes,
+// until ctx is done or onUpdate fails.
+func Watch(ctx context.Context, codePath string, cfg Config, onUpdate func(summary *CodeSummary) error) error {
+
+	a, err := newAnalyzerForConfig(os.DirFS(codePath), cfg)
+	if err != nil {
+		return err
+	}
+	a.files = make(map[string][]*fileResult)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch '%v': %v", codePath, err)
+	}
+	defer watcher.Close()
+
+	watchDir := func(path string) error {
+		err := watcher.Add(filepath.Join(codePath, filepath.FromSlash(path)))
+		if err != nil {
+			return fmt.Errorf("failed to watch '%v': %v", path, err)
+		}
+		return nil
+	}
+
+	err = a.walk(ctx, ".", watchDir)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to walk files: %v", err)
+	}
+	err = onUpdate(a.summarize().clone())
+	if err != nil {
+		return err
+	}
+
+	changedPaths := make(map[string]bool)
+	debounce := time.NewTimer(watchDebounce)
+	debounce.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			relativePath, err := filepath.Rel(codePath, event.Name)
+			if err != nil {
+				return fmt.Errorf("failed to relativize path %v: %v", event.Name, err)
+			}
+			changedPaths[filepath.ToSlash(relativePath)] = true
+			debounce.Reset(watchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("watch error: %v", err)
+		case <-debounce.C:
+			for path := range changedPaths {
+				err = a.refresh(ctx, path, watchDir)
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					return nil
+				}
+				if err != nil {
+					// e.g. a file that was removed while reading it, fixed by its next event
+					log.Printf("failed to refresh '%v': %v", path, err)
+				}
+			}
+			changedPaths = make(map[string]bool)
+			err = onUpdate(a.summarize().clone())
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// refresh replaces the counters of a changed file, or of all files under a changed dir or .editorconfig file
+func (a *analyzer) refresh(ctx context.Context, filePath string, onDir func(path string) error) error {
+	if path.Base(filePath) == ".editorconfig" {
+		// the tab widths of the files under it may have changed
+		filePath = path.Dir(filePath)
+	}
+	a.remove(filePath)
+	a.dirFiles = nil
+	a.editorconfigs = nil
+
+	info, err := fs.Stat(a.fsys, filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		// new or moved dir, not watched yet
+		err = a.walk(ctx, filePath, onDir)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return a.visitPath(ctx, filePath, fs.FileInfoToDirEntry(info))
+}
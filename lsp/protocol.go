@@ -0,0 +1,123 @@
+package lsp
+
+import "encoding/json"
+
+// the subset of the language server protocol that is used to publish complexity hints
+
+type request struct {
+	Id     *json.RawMessage `json:"id"`
+	Method string           `json:"method"`
+	Params json.RawMessage  `json:"params"`
+}
+
+type response struct {
+	JsonRpc string           `json:"jsonrpc"`
+	Id      *json.RawMessage `json:"id"`
+	Result  interface{}      `json:"result"`
+}
+
+type errorResponse struct {
+	JsonRpc string           `json:"jsonrpc"`
+	Id      *json.RawMessage `json:"id"`
+	Error   *responseError   `json:"error"`
+}
+
+type notification struct {
+	JsonRpc string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+const (
+	methodNotFound = -32601
+	invalidParams  = -32602
+)
+
+type initializeResult struct {
+	Capabilities serverCapabilities `json:"capabilities"`
+	ServerInfo   serverInfo         `json:"serverInfo"`
+}
+
+type serverCapabilities struct {
+	TextDocumentSync int              `json:"textDocumentSync"`
+	CodeLensProvider *codeLensOptions `json:"codeLensProvider"`
+}
+
+// fullTextDocumentSync has clients send the whole document on every change
+const fullTextDocumentSync = 1
+
+type codeLensOptions struct {
+	ResolveProvider bool `json:"resolveProvider"`
+}
+
+type serverInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type textDocumentIdentifier struct {
+	Uri string `json:"uri"`
+}
+
+type textDocumentItem struct {
+	Uri        string `json:"uri"`
+	LanguageId string `json:"languageId"`
+	Text       string `json:"text"`
+}
+
+type didOpenParams struct {
+	TextDocument textDocumentItem `json:"textDocument"`
+}
+
+type didChangeParams struct {
+	TextDocument   textDocumentIdentifier `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+type textDocumentParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type command struct {
+	Title   string `json:"title"`
+	Command string `json:"command"`
+}
+
+type codeLens struct {
+	Range   lspRange `json:"range"`
+	Command command  `json:"command"`
+}
+
+type diagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+const (
+	severityWarning     = 2
+	severityInformation = 3
+)
+
+type publishDiagnosticsParams struct {
+	Uri         string       `json:"uri"`
+	Diagnostics []diagnostic `json:"diagnostics"`
+}
@@ -0,0 +1,259 @@
+package lsp
+
+import (
+	"bufio"
+	"code-complexity/calculate"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+type Config struct {
+	Version string
+	// MaxFunctionKeywords publishes a warning on functions with more keywords, or none if zero
+	MaxFunctionKeywords float64
+	// Analysis is applied to every document, along with the .editorconfig files above it
+	Analysis calculate.Config
+}
+
+type server struct {
+	cfg       Config
+	reader    *textproto.Reader
+	writer    io.Writer
+	documents map[string]*document
+}
+
+type document struct {
+	lines   []string
+	summary *calculate.FileSummary
+}
+
+// languageIdToLanguage maps editor language identifiers, where the file extension is not enough
+var languageIdToLanguage = map[string]calculate.Language{
+	"javascriptreact": "javascript",
+	"typescriptreact": "typescript",
+	"objective-c":     "objectivec",
+	"objective-cpp":   "objectivec",
+	"matlab":          "matlab",
+	"shellscript":     "shell",
+	"aspnetcorerazor": "razor",
+}
+
+// Serve speaks the language server protocol over in and out, publishing code lenses with the counters of every
+// function in the open documents, until the client asks to exit.
+func Serve(in io.Reader, out io.Writer, cfg Config) error {
+	s := &server{
+		cfg:       cfg,
+		reader:    textproto.NewReader(bufio.NewReader(in)),
+		writer:    out,
+		documents: make(map[string]*document),
+	}
+	for {
+		req, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+		err = s.handle(req)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *server) read() (*request, error) {
+	header, err := s.reader.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	contentLength, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid content length: %v", err)
+	}
+	body := make([]byte, contentLength)
+	_, err = io.ReadFull(s.reader.R, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message: %v", err)
+	}
+	req := &request{}
+	err = json.Unmarshal(body, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse message: %v", err)
+	}
+	return req, nil
+}
+
+func (s *server) write(message interface{}) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to serialize message: %v", err)
+	}
+	_, err = fmt.Fprintf(s.writer, "Content-Length: %v\r\n\r\n%s", len(body), body)
+	return err
+}
+
+func (s *server) handle(req *request) error {
+	var result interface{}
+	var err error
+	switch req.Method {
+	case "initialize":
+		result = &initializeResult{
+			Capabilities: serverCapabilities{
+				TextDocumentSync: fullTextDocumentSync,
+				CodeLensProvider: &codeLensOptions{},
+			},
+			ServerInfo: serverInfo{Name: "complexity", Version: s.cfg.Version},
+		}
+	case "shutdown":
+		result = nil
+	case "textDocument/didOpen":
+		params := &didOpenParams{}
+		if err = json.Unmarshal(req.Params, params); err == nil {
+			return s.update(params.TextDocument.Uri, params.TextDocument.LanguageId, params.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		params := &didChangeParams{}
+		if err = json.Unmarshal(req.Params, params); err == nil && len(params.ContentChanges) > 0 {
+			return s.update(params.TextDocument.Uri, "", params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+	case "textDocument/didClose":
+		params := &textDocumentParams{}
+		if err = json.Unmarshal(req.Params, params); err == nil {
+			delete(s.documents, params.TextDocument.Uri)
+			return s.write(&notification{
+				JsonRpc: "2.0",
+				Method:  "textDocument/publishDiagnostics",
+				Params:  &publishDiagnosticsParams{Uri: params.TextDocument.Uri, Diagnostics: []diagnostic{}},
+			})
+		}
+	case "textDocument/codeLens":
+		params := &textDocumentParams{}
+		if err = json.Unmarshal(req.Params, params); err == nil {
+			result = s.codeLenses(params.TextDocument.Uri)
+		}
+	default:
+		if req.Id == nil {
+			// notifications that are not needed, e.g. initialized or didSave
+			return nil
+		}
+		return s.write(&errorResponse{
+			JsonRpc: "2.0",
+			Id:      req.Id,
+			Error:   &responseError{Code: methodNotFound, Message: fmt.Sprintf("method '%v' is not supported", req.Method)},
+		})
+	}
+
+	if req.Id == nil {
+		if err != nil {
+			log.Printf("invalid %v notification: %v", req.Method, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return s.write(&errorResponse{
+			JsonRpc: "2.0",
+			Id:      req.Id,
+			Error:   &responseError{Code: invalidParams, Message: err.Error()},
+		})
+	}
+	return s.write(&response{JsonRpc: "2.0", Id: req.Id, Result: result})
+}
+
+// update analyzes the new content of a document and publishes its diagnostics
+func (s *server) update(uri string, languageId string, text string) error {
+	doc, found := s.documents[uri]
+	if !found {
+		doc = &document{}
+		s.documents[uri] = doc
+	}
+	doc.lines = strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	path := uri
+	if parsed, err := url.Parse(uri); err == nil && len(parsed.Path) > 0 {
+		path = parsed.Path
+	}
+	language := languageIdToLanguage[languageId]
+	if len(language) == 0 && doc.summary != nil {
+		language = doc.summary.Language
+	}
+	summary, err := calculate.AnalyzeCodeWithConfig(path, []byte(text), language, s.cfg.Analysis)
+	if err != nil {
+		// not a supported language
+		summary = nil
+	}
+	doc.summary = summary
+
+	return s.write(&notification{
+		JsonRpc: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params:  &publishDiagnosticsParams{Uri: uri, Diagnostics: s.diagnostics(doc)},
+	})
+}
+
+func (s *server) diagnostics(doc *document) []diagnostic {
+	diagnostics := []diagnostic{}
+	if doc.summary == nil || s.cfg.MaxFunctionKeywords <= 0 {
+		return diagnostics
+	}
+	for _, function := range doc.summary.Functions {
+		if function.Counters.Keywords <= s.cfg.MaxFunctionKeywords {
+			continue
+		}
+		diagnostics = append(diagnostics, diagnostic{
+			Range:    functionRange(doc, function),
+			Severity: severityWarning,
+			Source:   "complexity",
+			Message: fmt.Sprintf(
+				"function '%v' has %v keywords (%.2f per line), over the limit of %v",
+				function.Name, function.Counters.Keywords, function.Counters.KeywordsComplexity, s.cfg.MaxFunctionKeywords,
+			),
+		})
+	}
+	return diagnostics
+}
+
+func (s *server) codeLenses(uri string) []codeLens {
+	lenses := []codeLens{}
+	doc, found := s.documents[uri]
+	if !found || doc.summary == nil {
+		return lenses
+	}
+	for _, function := range doc.summary.Functions {
+		lenses = append(lenses, codeLens{
+			Range:   functionRange(doc, function),
+			Command: command{Title: lensTitle(function.Counters)},
+		})
+	}
+	return lenses
+}
+
+func lensTitle(counters *calculate.FileCounters) string {
+	return fmt.Sprintf(
+		"keywords %v, %.2f/line · indentations %.2f/line · %v lines of code",
+		counters.Keywords, counters.KeywordsComplexity, counters.IndentationsComplexity, counters.LinesOfCode,
+	)
+}
+
+// functionRange is the declaration line of the function, in utf-16 characters as the protocol expects
+func functionRange(doc *document, function *calculate.FunctionSummary) lspRange {
+	line := function.StartLine - 1
+	length := 0
+	if line < len(doc.lines) {
+		length = len(utf16.Encode([]rune(doc.lines[line])))
+	}
+	return lspRange{
+		Start: position{Line: line},
+		End:   position{Line: line, Character: length},
+	}
+}
@@ -0,0 +1,90 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/textproto"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func messagesOf(messages ...string) *bytes.Buffer {
+	in := &bytes.Buffer{}
+	for _, message := range messages {
+		_, _ = fmt.Fprintf(in, "Content-Length: %v\r\n\r\n%v", len(message), message)
+	}
+	return in
+}
+
+func readMessages(out *bytes.Buffer) []map[string]interface{} {
+	reader := textproto.NewReader(bufio.NewReader(out))
+	var messages []map[string]interface{}
+	for {
+		header, err := reader.ReadMIMEHeader()
+		if err != nil {
+			return messages
+		}
+		contentLength, err := strconv.Atoi(header.Get("Content-Length"))
+		if err != nil {
+			panic(err)
+		}
+		body := make([]byte, contentLength)
+		_, err = reader.R.Read(body)
+		if err != nil {
+			panic(err)
+		}
+		message := map[string]interface{}{}
+		err = json.Unmarshal(body, &message)
+		if err != nil {
+			panic(err)
+		}
+		messages = append(messages, message)
+	}
+}
+
+func TestServe(t *testing.T) {
+	r := require.New(t)
+
+	code := "package main\n\nfunc main() {\n\tif true {\n\t\tif false {\n\t\t\treturn\n\t\t}\n\t}\n}\n"
+	text, err := json.Marshal(code)
+	r.Nil(err)
+
+	in := messagesOf(
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","method":"initialized","params":{}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///src/main.go","languageId":"go","version":1,"text":`+string(text)+`}}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"textDocument/codeLens","params":{"textDocument":{"uri":"file:///src/main.go"}}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"textDocument/hover","params":{}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	)
+	out := &bytes.Buffer{}
+	err = Serve(in, out, Config{Version: "test", MaxFunctionKeywords: 3})
+	r.Nil(err)
+
+	messages := readMessages(out)
+	r.Len(messages, 5)
+
+	capabilities := messages[0]["result"].(map[string]interface{})["capabilities"].(map[string]interface{})
+	r.Equal(float64(1), capabilities["textDocumentSync"])
+
+	r.Equal("textDocument/publishDiagnostics", messages[1]["method"])
+	diagnostics := messages[1]["params"].(map[string]interface{})["diagnostics"].([]interface{})
+	r.Len(diagnostics, 1)
+	r.Contains(diagnostics[0].(map[string]interface{})["message"], "function 'main' has 4 keywords")
+
+	lenses := messages[2]["result"].([]interface{})
+	r.Len(lenses, 1)
+	lens := lenses[0].(map[string]interface{})
+	r.Equal(float64(2), lens["range"].(map[string]interface{})["start"].(map[string]interface{})["line"])
+	r.Equal("keywords 4, 0.57/line · indentations 1.29/line · 7 lines of code", lens["command"].(map[string]interface{})["title"])
+
+	r.Equal(float64(-32601), messages[3]["error"].(map[string]interface{})["code"])
+
+	r.Contains(messages[4], "result")
+	r.Nil(messages[4]["result"])
+}
@@ -2,17 +2,38 @@ package main
 
 import (
 	"code-complexity/calculate"
+	"code-complexity/lsp"
 	"code-complexity/options"
+	"code-complexity/server"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/urfave/cli/v2"
 )
 
 const VERSION = "1.0.8"
 
+func writeSummary(opts *options.Options, summary *calculate.CodeSummary) error {
+	asJson, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize summary to json: %v", err)
+	}
+	log.Printf("completed successfully at %v", opts.CodePath)
+	println(string(asJson))
+	if len(opts.OutputPath) > 0 {
+		err = os.WriteFile(opts.OutputPath, asJson, 0777)
+		if err != nil {
+			return fmt.Errorf("failed to write output to %v: %v", opts.OutputPath, err)
+		}
+	}
+	return nil
+}
+
 func main() {
 	cli.AppHelpTemplate =
 		`NAME:
@@ -20,6 +41,14 @@ func main() {
 
 USAGE:
    {{.Name}}{{range .Flags}}{{if and (not (eq .Name "help")) (not (eq .Name "version")) }} {{if .Required}}--{{.Name}} value{{end}}{{end}}{{end}} [optional flags]
+   {{.Name}} file [--language value] [--config value] [--tab-width value] <path>
+   {{.Name}} - --language value
+   {{.Name}} serve [optional flags]
+   {{.Name}} lsp [optional flags]
+   {{.Name}} cache clean [--cache-dir value]
+
+COMMANDS:{{range .Commands}}{{if not (eq .Name "help")}}
+   {{join .Names ", "}}{{"\t"}}{{.Usage}}{{end}}{{end}}
 
 OPTIONS:
    {{range .Flags}}{{.}}
@@ -34,27 +63,123 @@ OPTIONS:
 		Flags:   options.Flags,
 		Version: VERSION,
 		Action: func(ctx *cli.Context) error {
+			if ctx.Args().First() == "-" {
+				// complexity - --language go, flags after "-" are not parsed for the root command
+				return ctx.App.Run(append([]string{ctx.App.Name, "file"}, append(ctx.Args().Tail(), "-")...))
+			}
 			opts, err := options.ParseOptions(ctx)
 			if err != nil {
 				return err
 			}
+			if opts.Watch {
+				watchCtx, stop := signal.NotifyContext(ctx.Context, os.Interrupt, syscall.SIGTERM)
+				defer stop()
+				cfg, err := calculate.NewConfig(opts)
+				if err != nil {
+					return err
+				}
+				return calculate.Watch(watchCtx, opts.CodePath, cfg, func(summary *calculate.CodeSummary) error {
+					return writeSummary(opts, summary)
+				})
+			}
 			summary, err := calculate.Complexity(opts)
 			if err != nil {
 				return err
 			}
-			asJson, err := json.MarshalIndent(summary, "", "  ")
-			if err != nil {
-				return fmt.Errorf("failed to serialize summary to json: %v", err)
-			}
-			log.Printf("completed successfully at %v", opts.CodePath)
-			println(string(asJson))
-			if len(opts.OutputPath) > 0 {
-				err = os.WriteFile(opts.OutputPath, asJson, 0777)
-				if err != nil {
-					return fmt.Errorf("failed to write output to %v: %v", opts.OutputPath, err)
-				}
-			}
-			return nil
+			return writeSummary(opts, summary)
+		},
+		Commands: []*cli.Command{
+			{
+				Name:  "lsp",
+				Usage: "run a language server over stdio, showing the complexity of every function in the editor",
+				Flags: options.LspFlags,
+				Action: func(ctx *cli.Context) error {
+					return lsp.Serve(os.Stdin, os.Stdout, lsp.Config{
+						Version:             VERSION,
+						MaxFunctionKeywords: float64(ctx.Int("max-function-keywords")),
+						Analysis:            calculate.Config{TabWidth: ctx.Int("tab-width")},
+					})
+				},
+			},
+			{
+				Name:  "serve",
+				Usage: "serve the analysis over http, see README for the api",
+				Flags: options.ServeFlags,
+				Action: func(ctx *cli.Context) error {
+					opts, err := options.ParseServeOptions(ctx)
+					if err != nil {
+						return err
+					}
+					cfg, err := calculate.NewConfig(&opts.Options)
+					if err != nil {
+						return err
+					}
+					return server.ListenAndServe(opts.ListenAddress, server.Config{
+						Analysis:        cfg,
+						RootPath:        opts.RootPath,
+						MaxRequestBytes: opts.MaxRequestBytes,
+						MaxConcurrent:   opts.MaxConcurrent,
+					})
+				},
+			},
+			{
+				Name:  "cache",
+				Usage: "manage the cache of previous runs",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "clean",
+						Usage: "remove all cache entries",
+						Flags: options.CacheFlags,
+						Action: func(ctx *cli.Context) error {
+							dir, err := options.ParseCacheDir(ctx)
+							if err != nil {
+								return err
+							}
+							return calculate.CleanCache(dir)
+						},
+					},
+				},
+			},
+			{
+				Name:      "file",
+				Usage:     "print the counters of a single file, or of stdin when the path is -",
+				ArgsUsage: "<path>",
+				Flags:     options.FileFlags,
+				Action: func(ctx *cli.Context) error {
+					opts, err := options.ParseFileOptions(ctx)
+					if err != nil {
+						return err
+					}
+					var content []byte
+					if opts.Path == "-" {
+						content, err = io.ReadAll(os.Stdin)
+					} else {
+						content, err = os.ReadFile(opts.Path)
+					}
+					if err != nil {
+						return fmt.Errorf("failed to read %v: %v", opts.Path, err)
+					}
+					summary, err := calculate.AnalyzeCodeWithConfig(opts.Path, content, opts.Language, calculate.Config{
+						Languages: opts.Languages,
+						TabWidth:  opts.TabWidth,
+					})
+					if err != nil {
+						return err
+					}
+					asJson, err := json.MarshalIndent(summary, "", "  ")
+					if err != nil {
+						return fmt.Errorf("failed to serialize counters to json: %v", err)
+					}
+					fmt.Println(string(asJson))
+					if len(opts.OutputPath) > 0 {
+						err = os.WriteFile(opts.OutputPath, asJson, 0777)
+						if err != nil {
+							return fmt.Errorf("failed to write output to %v: %v", opts.OutputPath, err)
+						}
+					}
+					return nil
+				},
+			},
 		},
 	}
 
@@ -1,14 +1,110 @@
 package options
 
 type Config struct {
-	IncludePatterns []string `json:"include_patterns"`
-	ExcludePatterns []string `json:"exclude_patterns"`
+	IncludePatterns []string             `json:"include_patterns"`
+	ExcludePatterns []string             `json:"exclude_patterns"`
+	Languages       []LanguageDefinition `json:"languages"`
+}
+
+// LanguageDefinition is how files of a language are detected and counted, a definition with the name of a built-in
+// language replaces it
+type LanguageDefinition struct {
+	Name       string   `json:"name"`
+	Extensions []string `json:"extensions"`
+	// Filenames are exact file names, e.g. Makefile, matched before extensions
+	Filenames []string `json:"filenames"`
+	// Interpreters are named by the shebang of scripts without extension, e.g. python3 in #!/usr/bin/env python3
+	Interpreters []string `json:"interpreters"`
+	// LineComments are markers of lines that are comments only
+	LineComments  []string       `json:"line_comments"`
+	BlockComments []BlockComment `json:"block_comments"`
+	// ColumnComments are markers of comment lines at a fixed column, e.g. * at column 7 of cobol
+	ColumnComments []ColumnComment `json:"column_comments"`
+	// MarginColumns are left out of every line before counting it, e.g. the sequence numbers of cobol
+	MarginColumns int `json:"margin_columns"`
+	// StringDelimiters are where block comment markers are ignored, until the same delimiter closes the string
+	StringDelimiters []string `json:"string_delimiters"`
+	// CharLiterals is whether ' only quotes a single character, e.g. 'a', and is no string otherwise, e.g. the lifetime
+	// 'a in rust
+	CharLiterals bool     `json:"char_literals"`
+	Keywords     []string `json:"keywords"`
+	// CaseInsensitiveKeywords matches keywords in any case, e.g. BEGIN and begin
+	CaseInsensitiveKeywords bool `json:"case_insensitive_keywords"`
+	// EndKeywords close the block of the keyword after them, which is then not counted, e.g. End of End If in vb
+	EndKeywords []string `json:"end_keywords"`
+	// AtSignKeywords counts tokens starting with @, e.g. annotations, as keywords
+	AtSignKeywords bool `json:"at_sign_keywords"`
+	// Operators are counted by every occurrence as decisions, e.g. && or ?? in c#, ? is a ternary conditional
+	Operators []string `json:"operators"`
+	// TabWidth is the columns of a tab in indentations, overriding the tab-width flag, unless set by .editorconfig files
+	TabWidth int `json:"tab_width"`
+	// Braces are the blocks of the language, their depth is the nesting depth, otherwise it is by indentation levels
+	Braces bool `json:"braces"`
+	// BlockParentheses are the keywords whose ( ending a line opens a block rather than wrapped arguments, e.g. import (
+	// in go
+	BlockParentheses []string `json:"block_parentheses"`
+	// Commands is whether lines are commands rather than expressions, only continued by \, &&, || and |, e.g. in shell
+	Commands bool `json:"commands"`
+	// NoContinuations is whether brackets are blocks or text rather than wrapped expressions, e.g. in clojure
+	NoContinuations bool `json:"no_continuations"`
+	// Heredocs are shell style <<WORD documents, counted as lines of code but not by their indentation or keywords
+	Heredocs bool `json:"heredocs"`
+	// HereStrings are counted like heredocs, from the end of a line with their start to a line starting with their end,
+	// e.g. @" and "@ in powershell
+	HereStrings []HereString `json:"here_strings"`
+	// Jsx is whether the files may contain jsx elements, see the exclude-jsx-indentation flag
+	Jsx bool `json:"jsx"`
+	// Rollup is another language the files are also summarized under, e.g. node for javascript and typescript
+	Rollup string `json:"rollup"`
+	// Regions are parts of the files counted as other languages, e.g. <script> in vue
+	Regions []Region `json:"regions"`
+	// Markup is the language the lines out of regions are counted as, or they are not counted if empty
+	Markup string `json:"markup"`
+	// Notebook files are jupyter notebooks, their code cells are counted as the language of their kernel
+	Notebook bool `json:"notebook"`
+}
+
+type BlockComment struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// Nested comments end only when every start in them is ended, e.g. {- {- -} -} in haskell
+	Nested bool `json:"nested"`
+	// LineStart comments start only at the start of a line, e.g. =begin in ruby
+	LineStart bool `json:"line_start"`
+	// OwnLine comments start and end only by a line of nothing but their marker, e.g. %{ and %} in matlab
+	OwnLine bool `json:"own_line"`
+}
+
+type HereString struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+type ColumnComment struct {
+	// Column is 1-based, in the line before its margin is left out
+	Column  int      `json:"column"`
+	Markers []string `json:"markers"`
+}
+
+// Region starts at a match of Start, a regular expression, and ends at End. When Start has a group, the region starts
+// at the group and includes End, e.g. if (x) { } of @if (x) { } in razor
+type Region struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// Language counts the region, or it is not counted at all if empty, e.g. a comment
+	Language string `json:"language"`
+	// Braces end the region at the End closing every brace opened since Start, e.g. @{ if (x) { } } in razor
+	Braces bool `json:"braces"`
 }
 
 var defaultConfig = &Config{
 	IncludePatterns: []string{},
 	ExcludePatterns: []string{
-		"**/bin",
+		"**/bin/Debug",
+		"**/bin/Release",
+		// e.g. bin/x64/Debug of a platform target
+		"**/bin/**/Debug",
+		"**/bin/**/Release",
 		"**/obj",
 		"**/venv",
 		"**/node_modules",
@@ -29,3 +125,8 @@ var defaultConfig = &Config{
 		"**/*spec.*",
 	},
 }
+
+// DefaultExcludePatterns are the exclude patterns used when no config file is given
+func DefaultExcludePatterns() []string {
+	return append([]string{}, defaultConfig.ExcludePatterns...)
+}
@@ -16,14 +16,14 @@ var Flags = []cli.Flag{
 	&cli.StringFlag{
 		Name:     "dir",
 		Aliases:  []string{"d"},
-		Usage:    "path to directory containing directory path, defaults to current directory",
+		Usage:    "path to directory containing directory path, or to a zip/jar/tar/tar.gz archive, defaults to current directory",
 		Required: false,
 	},
 	&cli.StringFlag{
 		Name:     "config",
 		Aliases:  []string{"c"},
 		Value:    "unset",
-		Usage:    "include/exclude patterns config file",
+		Usage:    "include/exclude patterns and language definitions config file",
 		Required: false,
 	},
 	&cli.StringFlag{
@@ -60,16 +60,192 @@ var Flags = []cli.Flag{
 		Usage:    "maximal file size, in MB",
 		Required: false,
 	},
+	&cli.BoolFlag{
+		Name:     "watch",
+		Aliases:  []string{"w"},
+		Value:    false,
+		Usage:    "keep running after the first scan, re-analyzing changed files and updating the output",
+		Required: false,
+	},
+	&cli.BoolFlag{
+		Name:     "exclude-jsx-indentation",
+		Value:    false,
+		Usage:    "leave lines of jsx elements out of the indentation counters of javascript and typescript",
+		Required: false,
+	},
+	&cli.IntFlag{
+		Name:     "max-nesting",
+		Value:    4,
+		Usage:    "count lines of code nested deeper than this depth as deep lines",
+		Required: false,
+	},
+	&cli.IntFlag{
+		Name:     "tab-width",
+		Value:    4,
+		Usage:    "columns of a tab in indentations, unless set by the language or by .editorconfig files",
+		Required: false,
+	},
+	&cli.BoolFlag{
+		Name:     "sql-dialects",
+		Value:    false,
+		Usage:    "summarize sql files as plsql, tsql or plpgsql by their content, in addition to sql",
+		Required: false,
+	},
+	&cli.BoolFlag{
+		Name:     "cache",
+		Value:    false,
+		Usage:    "reuse the counters of unchanged files from previous runs",
+		Required: false,
+	},
+	&cli.StringFlag{
+		Name:     "cache-dir",
+		Value:    "",
+		Usage:    "cache directory, defaults to code-complexity under the user cache directory",
+		Required: false,
+	},
+	&cli.IntFlag{
+		Name:     "cache-max-size",
+		Value:    512,
+		Usage:    "maximal cache size, in MB, least recently used entries are removed beyond it, 0 for no limit",
+		Required: false,
+	},
+	&cli.IntFlag{
+		Name:     "archive-depth",
+		Value:    0,
+		Usage:    "maximal depth of nested archives (zip/jar/tar/tar.gz) to analyze, 0 to skip archives found in the directory",
+		Required: false,
+	},
+	&cli.IntFlag{
+		Name:     "archive-max-entries",
+		Value:    100000,
+		Usage:    "maximal number of entries in analyzed archives, 0 for no limit",
+		Required: false,
+	},
+	&cli.IntFlag{
+		Name:     "archive-max-size",
+		Value:    1024,
+		Usage:    "maximal uncompressed size of analyzed archives, in MB, 0 for no limit",
+		Required: false,
+	},
+}
+
+var FileFlags = append(
+	[]cli.Flag{
+		&cli.StringFlag{
+			Name:     "language",
+			Aliases:  []string{"l"},
+			Value:    "",
+			Usage:    "language of the input, required when reading from stdin, otherwise detected by the file extension",
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     "out",
+			Aliases:  []string{"o"},
+			Value:    "",
+			Usage:    "output file, or empty to print to stdout",
+			Required: false,
+		},
+	},
+	pickFlags("config", "tab-width")...,
+)
+
+var ServeFlags = append(
+	[]cli.Flag{
+		&cli.StringFlag{
+			Name:     "listen",
+			Aliases:  []string{"l"},
+			Value:    "127.0.0.1:8080",
+			Usage:    "address to listen on, e.g. :8080 for all interfaces",
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     "root",
+			Value:    "",
+			Usage:    "directory on the server that requests may reference paths under, or empty to accept uploads only",
+			Required: false,
+		},
+		&cli.IntFlag{
+			Name:     "max-request-size",
+			Value:    100,
+			Usage:    "maximal request body size, in MB",
+			Required: false,
+		},
+		&cli.IntFlag{
+			Name:     "max-concurrent",
+			Value:    4,
+			Usage:    "maximal number of concurrently analyzed requests, further requests are rejected",
+			Required: false,
+		},
+	},
+	pickFlags("config", "include", "exclude", "verbose", "max-size", "archive-depth", "archive-max-entries", "archive-max-size", "exclude-jsx-indentation", "max-nesting", "tab-width", "sql-dialects", "cache", "cache-dir", "cache-max-size")...,
+)
+
+var LspFlags = append(
+	[]cli.Flag{
+		&cli.IntFlag{
+			Name:     "max-function-keywords",
+			Value:    15,
+			Usage:    "warn on functions with more keywords, 0 to only show code lenses",
+			Required: false,
+		},
+	},
+	pickFlags("tab-width")...,
+)
+
+var CacheFlags = pickFlags("cache-dir")
+
+func pickFlags(names ...string) []cli.Flag {
+	picked := make([]cli.Flag, 0, len(names))
+	for _, name := range names {
+		for _, flag := range Flags {
+			if flag.Names()[0] == name {
+				picked = append(picked, flag)
+			}
+		}
+	}
+	return picked
 }
 
 type Options struct {
-	CodePath         string
-	ConfigFie        string
-	OutputPath       string
-	IncludePatterns  []string
-	ExcludePatterns  []string
-	VerboseLogging   bool
-	MaxFileSizeBytes int64
+	CodePath          string
+	ConfigFie         string
+	OutputPath        string
+	Watch             bool
+	IncludePatterns   []string
+	ExcludePatterns   []string
+	VerboseLogging    bool
+	MaxFileSizeBytes  int64
+	MaxArchiveDepth   int
+	MaxArchiveEntries int
+	MaxArchiveBytes   int64
+	// CacheDir is the cache location, or empty when the cache is disabled
+	CacheDir      string
+	MaxCacheBytes int64
+	Version       string
+	// Languages are defined in the config file, in addition to the built-in ones
+	Languages             []LanguageDefinition
+	ExcludeJsxIndentation bool
+	DetectSqlDialects     bool
+	MaxNesting            int
+	TabWidth              int
+}
+
+// FileOptions are the options of analyzing a single file, or stdin when Path is "-"
+type FileOptions struct {
+	Path       string
+	Language   string
+	OutputPath string
+	Languages  []LanguageDefinition
+	TabWidth   int
+}
+
+// ServeOptions are the options of running as a service, with the analysis options applied to every request
+type ServeOptions struct {
+	Options
+	ListenAddress   string
+	RootPath        string
+	MaxRequestBytes int64
+	MaxConcurrent   int
 }
 
 func splitListFlag(flag string) []string {
@@ -100,24 +276,91 @@ func validateDirectory(dirPath string, createIfNotExist bool) error {
 	return nil
 }
 
-func ParseOptions(c *cli.Context) (*Options, error) {
-	opts := &Options{
-		CodePath:         c.String("dir"),
-		OutputPath:       c.String("out"),
-		ConfigFie:        c.String("config"),
-		IncludePatterns:  splitListFlag(c.String("include")),
-		ExcludePatterns:  splitListFlag(c.String("exclude")),
-		VerboseLogging:   c.Bool("verbose"),
-		MaxFileSizeBytes: int64(c.Int("max-size")) * 1024 * 1024,
+func validateCodePath(codePath string) error {
+	info, err := os.Stat(codePath)
+	if err == nil && info.Mode().IsRegular() {
+		// archive, validated by its format when analyzed
+		return nil
+	}
+	return validateDirectory(codePath, false)
+}
+
+// readConfig reads the config file, or returns the default one when unset
+func readConfig(configFile string) (*Config, error) {
+	cfg := &Config{}
+	if configFile == "unset" {
+		cfg = defaultConfig
+	} else {
+		if _, statErr := os.Stat(configFile); !errors.Is(statErr, fs.ErrNotExist) {
+			log.Printf("will read config from %v", configFile)
+			fileContent, err := os.ReadFile(configFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read Config file at %v: %v", configFile, err)
+			}
+			err = json.Unmarshal(fileContent, &cfg)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse Config file at %v: %v", configFile, err)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// applyConfig adds the include/exclude patterns and language definitions of the config file, or the default ones, to opts
+func applyConfig(opts *Options) error {
+	cfg, err := readConfig(opts.ConfigFie)
+	if err != nil {
+		return err
 	}
+
+	if len(cfg.IncludePatterns) > 0 {
+		opts.IncludePatterns = append(opts.IncludePatterns, cfg.IncludePatterns...)
+	}
+	if len(cfg.ExcludePatterns) > 0 {
+		opts.ExcludePatterns = append(opts.ExcludePatterns, cfg.ExcludePatterns...)
+	}
+	opts.Languages = cfg.Languages
+
+	return nil
+}
+
+func parseAnalysisOptions(c *cli.Context) *Options {
+	return &Options{
+		ConfigFie:             c.String("config"),
+		IncludePatterns:       splitListFlag(c.String("include")),
+		ExcludePatterns:       splitListFlag(c.String("exclude")),
+		VerboseLogging:        c.Bool("verbose"),
+		MaxFileSizeBytes:      int64(c.Int("max-size")) * 1024 * 1024,
+		MaxArchiveDepth:       c.Int("archive-depth"),
+		MaxArchiveEntries:     c.Int("archive-max-entries"),
+		MaxArchiveBytes:       int64(c.Int("archive-max-size")) * 1024 * 1024,
+		MaxCacheBytes:         int64(c.Int("cache-max-size")) * 1024 * 1024,
+		Version:               c.App.Version,
+		ExcludeJsxIndentation: c.Bool("exclude-jsx-indentation"),
+		DetectSqlDialects:     c.Bool("sql-dialects"),
+		MaxNesting:            c.Int("max-nesting"),
+		TabWidth:              c.Int("tab-width"),
+	}
+}
+
+func ParseOptions(c *cli.Context) (*Options, error) {
+	opts := parseAnalysisOptions(c)
+	opts.CodePath = c.String("dir")
+	opts.OutputPath = c.String("out")
+	opts.Watch = c.Bool("watch")
 	var err error
 	if len(opts.CodePath) == 0 {
 		opts.CodePath, err = os.Getwd()
 		if err != nil {
 			return nil, fmt.Errorf("failed to get working directory: %v", err)
 		}
-	} else {
+	} else if opts.Watch {
 		err = validateDirectory(opts.CodePath, false)
+		if err != nil {
+			return nil, fmt.Errorf("directory path '%v' is not valid for watching: %v", opts.CodePath, err)
+		}
+	} else {
+		err = validateCodePath(opts.CodePath)
 		if err != nil {
 			return nil, fmt.Errorf("directory path '%v' is not valid: %v", opts.CodePath, err)
 		}
@@ -131,29 +374,110 @@ func ParseOptions(c *cli.Context) (*Options, error) {
 		}
 	}
 
-	cfg := &Config{}
-	if opts.ConfigFie == "unset" {
-		cfg = defaultConfig
+	err = applyConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Bool("cache") {
+		opts.CacheDir, err = ParseCacheDir(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return opts, nil
+}
+
+func ParseFileOptions(c *cli.Context) (*FileOptions, error) {
+	if c.NArg() != 1 {
+		return nil, fmt.Errorf("expected a single file path, or - for stdin, after any flags")
+	}
+	opts := &FileOptions{
+		Path:       c.Args().First(),
+		Language:   c.String("language"),
+		OutputPath: c.String("out"),
+		TabWidth:   c.Int("tab-width"),
+	}
+	if opts.Path == "-" {
+		if len(opts.Language) == 0 {
+			return nil, fmt.Errorf("language is required when reading from stdin")
+		}
 	} else {
-		if _, statErr := os.Stat(opts.ConfigFie); !errors.Is(statErr, fs.ErrNotExist) {
-			log.Printf("will read config from %v", opts.ConfigFie)
-			fileContent, err := os.ReadFile(opts.ConfigFie)
-			if err != nil {
-				return nil, fmt.Errorf("failed to read Config file at %v: %v", opts.ConfigFie, err)
-			}
-			err = json.Unmarshal(fileContent, &cfg)
-			if err != nil {
-				return nil, fmt.Errorf("failed to parse Config file at %v: %v", opts.ConfigFie, err)
-			}
+		info, err := os.Stat(opts.Path)
+		if err != nil {
+			return nil, fmt.Errorf("file path '%v' is not valid: %v", opts.Path, err)
+		}
+		if !info.Mode().IsRegular() {
+			return nil, fmt.Errorf("file path '%v' is not a regular file", opts.Path)
 		}
 	}
 
-	if len(cfg.IncludePatterns) > 0 {
-		opts.IncludePatterns = append(opts.IncludePatterns, cfg.IncludePatterns...)
+	if len(opts.OutputPath) > 0 {
+		err := validateDirectory(filepath.Dir(opts.OutputPath), true)
+		if err != nil {
+			return nil, fmt.Errorf("output path '%v' is not valid: %v", opts.OutputPath, err)
+		}
 	}
-	if len(cfg.ExcludePatterns) > 0 {
-		opts.ExcludePatterns = append(opts.ExcludePatterns, cfg.ExcludePatterns...)
+
+	cfg, err := readConfig(c.String("config"))
+	if err != nil {
+		return nil, err
 	}
+	opts.Languages = cfg.Languages
 
 	return opts, nil
 }
+
+func ParseServeOptions(c *cli.Context) (*ServeOptions, error) {
+	opts := &ServeOptions{
+		Options:         *parseAnalysisOptions(c),
+		ListenAddress:   c.String("listen"),
+		RootPath:        c.String("root"),
+		MaxRequestBytes: int64(c.Int("max-request-size")) * 1024 * 1024,
+		MaxConcurrent:   c.Int("max-concurrent"),
+	}
+	if len(opts.RootPath) > 0 {
+		rootPath, err := filepath.Abs(opts.RootPath)
+		if err != nil {
+			return nil, fmt.Errorf("root path '%v' is not valid: %v", opts.RootPath, err)
+		}
+		err = validateDirectory(rootPath, false)
+		if err != nil {
+			return nil, fmt.Errorf("root path '%v' is not valid: %v", opts.RootPath, err)
+		}
+		opts.RootPath = rootPath
+	}
+	if opts.MaxRequestBytes < 1 {
+		return nil, fmt.Errorf("max request size must be positive, got %v", c.Int("max-request-size"))
+	}
+	if opts.MaxConcurrent < 1 {
+		return nil, fmt.Errorf("max concurrent requests must be positive, got %v", opts.MaxConcurrent)
+	}
+
+	err := applyConfig(&opts.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Bool("cache") {
+		opts.CacheDir, err = ParseCacheDir(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return opts, nil
+}
+
+// ParseCacheDir is the given cache directory, or code-complexity under the user cache directory
+func ParseCacheDir(c *cli.Context) (string, error) {
+	if dir := c.String("cache-dir"); len(dir) > 0 {
+		return dir, nil
+	}
+	userCacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user cache directory: %v", err)
+	}
+	return filepath.Join(userCacheDir, "code-complexity"), nil
+}
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"code-complexity/calculate"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	// Analysis is applied to every request, with the request patterns added to it
+	Analysis calculate.Config
+	// RootPath is the directory that requests may reference paths under, or empty to accept uploads only
+	RootPath        string
+	MaxRequestBytes int64
+	MaxConcurrent   int
+}
+
+type handler struct {
+	cfg   Config
+	slots chan struct{}
+}
+
+// NewHandler serves POST /analyze, returning the code summary of either:
+//   - a zip, tar or tar.gz archive body, by its content type
+//   - multipart form files, each at the path of its form field name
+//   - a directory or archive under the root path, by the path query parameter
+//
+// include and exclude query parameters add comma delimited patterns to the configured ones.
+func NewHandler(cfg Config) http.Handler {
+	h := &handler{
+		cfg:   cfg,
+		slots: make(chan struct{}, cfg.MaxConcurrent),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/analyze", h.analyze)
+	mux.HandleFunc("/health", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return mux
+}
+
+func ListenAndServe(address string, cfg Config) error {
+	httpServer := &http.Server{
+		Addr:              address,
+		Handler:           NewHandler(cfg),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("listening on %v", address)
+	return httpServer.ListenAndServe()
+}
+
+type requestError struct {
+	status int
+	err    error
+}
+
+func (e *requestError) Error() string {
+	return e.err.Error()
+}
+
+func badRequest(format string, v ...interface{}) error {
+	return &requestError{status: http.StatusBadRequest, err: fmt.Errorf(format, v...)}
+}
+
+func (h *handler) analyze(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	select {
+	case h.slots <- struct{}{}:
+		defer func() { <-h.slots }()
+	default:
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "too many concurrent requests", http.StatusServiceUnavailable)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.cfg.MaxRequestBytes)
+	summary, err := h.summarize(r)
+	if err != nil {
+		status := http.StatusInternalServerError
+		var reqErr *requestError
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &reqErr) {
+			status = reqErr.status
+		} else if errors.As(err, &maxBytesErr) {
+			status = http.StatusRequestEntityTooLarge
+		} else if r.Context().Err() != nil {
+			// client is gone
+			return
+		}
+		log.Printf("failed to analyze request: %v", err)
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	asJson, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to serialize summary to json: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(asJson)
+}
+
+func (h *handler) summarize(r *http.Request) (*calculate.CodeSummary, error) {
+	cfg := h.cfg.Analysis
+	query := r.URL.Query()
+	if include := query.Get("include"); len(include) > 0 {
+		cfg.IncludePatterns = append(append([]string{}, cfg.IncludePatterns...), strings.Split(include, ",")...)
+	}
+	if exclude := query.Get("exclude"); len(exclude) > 0 {
+		cfg.ExcludePatterns = append(append([]string{}, cfg.ExcludePatterns...), strings.Split(exclude, ",")...)
+	}
+
+	if codePath := query.Get("path"); len(codePath) > 0 {
+		return h.summarizePath(r, codePath, cfg)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, badRequest("invalid content type: %v", err)
+	}
+	if mediaType == "multipart/form-data" {
+		return h.summarizeForm(r, cfg)
+	}
+
+	archiveName, supported := archiveNamesByMediaType[mediaType]
+	if !supported {
+		return nil, &requestError{status: http.StatusUnsupportedMediaType, err: fmt.Errorf("content type '%v' is not supported", mediaType)}
+	}
+	dir, err := os.MkdirTemp("", "complexity-request-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	err = writeFile(filepath.Join(dir, archiveName), r.Body)
+	if err != nil {
+		return nil, err
+	}
+	return calculate.AnalyzeArchive(r.Context(), os.DirFS(dir), archiveName, cfg)
+}
+
+var archiveNamesByMediaType = map[string]string{
+	"application/zip":              "request.zip",
+	"application/java-archive":     "request.jar",
+	"application/x-tar":            "request.tar",
+	"application/gzip":             "request.tar.gz",
+	"application/x-gzip":           "request.tar.gz",
+	"application/x-compressed-tar": "request.tar.gz",
+}
+
+func (h *handler) summarizePath(r *http.Request, codePath string, cfg calculate.Config) (*calculate.CodeSummary, error) {
+	if len(h.cfg.RootPath) == 0 {
+		return nil, &requestError{status: http.StatusForbidden, err: errors.New("paths on the server are not allowed")}
+	}
+	// cleaned as absolute first, so the path can never escape the root
+	fullPath := filepath.Join(h.cfg.RootPath, filepath.FromSlash(path.Clean("/"+codePath)))
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, &requestError{status: http.StatusNotFound, err: fmt.Errorf("path '%v' was not found", codePath)}
+	}
+	if info.IsDir() {
+		return calculate.Analyze(r.Context(), os.DirFS(fullPath), cfg)
+	}
+	return calculate.AnalyzeArchive(r.Context(), os.DirFS(filepath.Dir(fullPath)), filepath.Base(fullPath), cfg)
+}
+
+func (h *handler) summarizeForm(r *http.Request, cfg calculate.Config) (*calculate.CodeSummary, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, badRequest("invalid multipart form: %v", err)
+	}
+	// the files are written to a temporary directory, which is analyzed like a directory on the server
+	dir, err := os.MkdirTemp("", "complexity-request-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		filePath := strings.TrimPrefix(path.Clean("/"+part.FormName()), "/")
+		if !fs.ValidPath(filePath) || filePath == "." {
+			return nil, badRequest("invalid file path '%v'", part.FormName())
+		}
+		fullPath := filepath.Join(dir, filepath.FromSlash(filePath))
+		err = os.MkdirAll(filepath.Dir(fullPath), 0o700)
+		if err != nil {
+			return nil, badRequest("invalid file path '%v': %v", part.FormName(), err)
+		}
+		err = writeFile(fullPath, part)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return calculate.Analyze(r.Context(), os.DirFS(dir), cfg)
+}
+
+// writeFile copies the reader to a new file at filePath
+func writeFile(filePath string, reader io.Reader) error {
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"code-complexity/calculate"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func postAnalyze(handler http.Handler, query string, contentType string, body []byte) (*httptest.ResponseRecorder, *calculate.CodeSummary) {
+	request := httptest.NewRequest(http.MethodPost, "/analyze"+query, bytes.NewReader(body))
+	request.Header.Set("Content-Type", contentType)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		return recorder, nil
+	}
+	summary := &calculate.CodeSummary{}
+	err := json.Unmarshal(recorder.Body.Bytes(), summary)
+	if err != nil {
+		panic(err)
+	}
+	return recorder, summary
+}
+
+func TestAnalyzeUploads(t *testing.T) {
+	r := require.New(t)
+
+	handler := NewHandler(Config{MaxRequestBytes: 1024 * 1024, MaxConcurrent: 1})
+
+	form := &bytes.Buffer{}
+	formWriter := multipart.NewWriter(form)
+	fileWriter, err := formWriter.CreateFormFile("src/main.go", "main.go")
+	r.Nil(err)
+	_, err = fileWriter.Write([]byte("package main\n\nfunc main() {\n}\n"))
+	r.Nil(err)
+	fileWriter, err = formWriter.CreateFormFile("../../etc/app.py", "app.py")
+	r.Nil(err)
+	_, err = fileWriter.Write([]byte("import os\n"))
+	r.Nil(err)
+	r.Nil(formWriter.Close())
+
+	recorder, summary := postAnalyze(handler, "?exclude=**/*.py", formWriter.FormDataContentType(), form.Bytes())
+	r.Equal(http.StatusOK, recorder.Code)
+	r.Len(summary.CountersByLanguage, 1)
+	r.Equal(float64(3), summary.CountersByLanguage["go"].Total.LinesOfCode)
+
+	archive := &bytes.Buffer{}
+	zipWriter := zip.NewWriter(archive)
+	fileWriter, err = zipWriter.Create("src/main.go")
+	r.Nil(err)
+	_, err = fileWriter.Write([]byte("package main\n"))
+	r.Nil(err)
+	r.Nil(zipWriter.Close())
+
+	recorder, summary = postAnalyze(handler, "", "application/zip", archive.Bytes())
+	r.Equal(http.StatusOK, recorder.Code)
+	r.Equal(float64(1), summary.CountersByLanguage["go"].NumberOfFiles)
+
+	recorder, _ = postAnalyze(handler, "", "text/plain", []byte("package main\n"))
+	r.Equal(http.StatusUnsupportedMediaType, recorder.Code)
+
+	recorder, _ = postAnalyze(handler, "", "application/zip", make([]byte, 2*1024*1024))
+	r.Equal(http.StatusRequestEntityTooLarge, recorder.Code)
+
+	recorder, _ = postAnalyze(handler, "?path=src", "", nil)
+	r.Equal(http.StatusForbidden, recorder.Code)
+}
+
+func TestAnalyzeRootPath(t *testing.T) {
+	r := require.New(t)
+
+	rootPath, err := os.MkdirTemp("", "")
+	r.Nil(err)
+	defer func() {
+		r.Nil(os.RemoveAll(rootPath))
+	}()
+	r.Nil(os.MkdirAll(filepath.Join(rootPath, "repo"), 0777))
+	r.Nil(os.WriteFile(filepath.Join(rootPath, "repo", "main.go"), []byte("package main\n"), 0777))
+
+	handler := NewHandler(Config{RootPath: rootPath, MaxRequestBytes: 1024, MaxConcurrent: 1})
+
+	recorder, summary := postAnalyze(handler, "?path=repo", "", nil)
+	r.Equal(http.StatusOK, recorder.Code)
+	r.Equal(float64(1), summary.CountersByLanguage["go"].NumberOfFiles)
+
+	recorder, summary = postAnalyze(handler, "?path=../../repo", "", nil)
+	r.Equal(http.StatusOK, recorder.Code)
+	r.Equal(float64(1), summary.CountersByLanguage["go"].NumberOfFiles)
+
+	recorder, _ = postAnalyze(handler, "?path=missing", "", nil)
+	r.Equal(http.StatusNotFound, recorder.Code)
+}
+
+func TestConcurrencyCap(t *testing.T) {
+	r := require.New(t)
+
+	h := &handler{cfg: Config{MaxRequestBytes: 1024, MaxConcurrent: 1}, slots: make(chan struct{}, 1)}
+	h.slots <- struct{}{}
+
+	recorder := httptest.NewRecorder()
+	h.analyze(recorder, httptest.NewRequest(http.MethodPost, "/analyze", bytes.NewReader(nil)))
+	r.Equal(http.StatusServiceUnavailable, recorder.Code)
+}